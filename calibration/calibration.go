@@ -0,0 +1,305 @@
+// Package calibration fits curves that convert load cell readings into
+// weights from a number of reference weights. It is used for the HX711 as
+// well as the NAU7802.
+//
+// A curve maps net counts, that is the raw reading minus the zero offset,
+// to a weight. So taring the scale again only moves the zero offset and
+// keeps the curve valid.
+package calibration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/SimonWaldherr/rpi-examples/jsonfile"
+)
+
+const (
+	Linear     = "linear"
+	Polynomial = "polynomial"
+	Piecewise  = "piecewise"
+)
+
+var (
+	ErrTooFewPoints = errors.New("calibration: not enough points for the fit")
+	ErrSingular     = errors.New("calibration: points do not determine the curve")
+	ErrUnknownKind  = errors.New("calibration: unknown curve kind")
+)
+
+// Point is one reference weight and the net counts measured for it.
+type Point struct {
+	Raw    float64 `json:"raw"`
+	Weight float64 `json:"weight"`
+}
+
+// Curve converts net counts to a weight. Polynomial and linear curves are
+// evaluated on the normalized input (raw-Center)/Scale to keep the fit
+// well conditioned, Coefficients start with the constant term. Piecewise
+// curves interpolate linearly between Points and extrapolate the first and
+// last segment.
+type Curve struct {
+	Kind         string    `json:"kind"`
+	Center       float64   `json:"center,omitempty"`
+	Scale        float64   `json:"scale,omitempty"`
+	Coefficients []float64 `json:"coefficients,omitempty"`
+	Points       []Point   `json:"points,omitempty"`
+}
+
+// Residual is the deviation of a curve from one reference point.
+type Residual struct {
+	Point
+	Fitted float64
+	Error  float64
+}
+
+// Fit fits a curve of the given kind to points. For Polynomial the degree
+// is given, Linear is a polynomial of degree 1 and Piecewise ignores it.
+func Fit(kind string, degree int, points []Point) (Curve, error) {
+	switch kind {
+	case Linear:
+		c, err := FitPolynomial(points, 1)
+		c.Kind = Linear
+		return c, err
+	case Polynomial:
+		return FitPolynomial(points, degree)
+	case Piecewise:
+		return FitPiecewise(points)
+	}
+	return Curve{}, ErrUnknownKind
+}
+
+// ParseKind parses the names used on the command line: linear, piecewise
+// and polyN for a polynomial of degree N.
+func ParseKind(s string) (kind string, degree int, err error) {
+	switch {
+	case s == Linear:
+		return Linear, 1, nil
+	case s == Piecewise:
+		return Piecewise, 0, nil
+	case strings.HasPrefix(s, "poly"):
+		degree, err = strconv.Atoi(strings.TrimPrefix(s, "poly"))
+		if err != nil || degree < 1 {
+			return "", 0, fmt.Errorf("calibration: invalid polynomial degree in %q", s)
+		}
+		return Polynomial, degree, nil
+	}
+	return "", 0, ErrUnknownKind
+}
+
+// FitPolynomial fits a polynomial of the given degree with least squares.
+// It needs at least degree+1 points with distinct raw values.
+func FitPolynomial(points []Point, degree int) (Curve, error) {
+	if degree < 1 || len(points) < degree+1 {
+		return Curve{}, ErrTooFewPoints
+	}
+
+	lo, hi := points[0].Raw, points[0].Raw
+	for _, p := range points {
+		lo = math.Min(lo, p.Raw)
+		hi = math.Max(hi, p.Raw)
+	}
+
+	c := Curve{Kind: Polynomial, Center: (lo + hi) / 2, Scale: (hi - lo) / 2}
+	if c.Scale == 0 {
+		return Curve{}, ErrSingular
+	}
+
+	// normal equations A x = b of the least squares problem
+	n := degree + 1
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n+1)
+	}
+
+	for _, p := range points {
+		x := c.normalize(p.Raw)
+		pow := make([]float64, 2*n)
+		pow[0] = 1
+		for i := 1; i < len(pow); i++ {
+			pow[i] = pow[i-1] * x
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				a[i][j] += pow[i+j]
+			}
+			a[i][n] += pow[i] * p.Weight
+		}
+	}
+
+	coeffs, err := solve(a)
+	if err != nil {
+		return Curve{}, err
+	}
+	c.Coefficients = coeffs
+
+	return c, nil
+}
+
+// FitPiecewise builds a piecewise linear curve through all points. It needs
+// at least two points, points with equal raw values are averaged.
+func FitPiecewise(points []Point) (Curve, error) {
+	sorted := append([]Point(nil), points...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Raw < sorted[j].Raw })
+
+	var merged []Point
+	for i := 0; i < len(sorted); {
+		j, sum := i, 0.0
+		for ; j < len(sorted) && sorted[j].Raw == sorted[i].Raw; j++ {
+			sum += sorted[j].Weight
+		}
+		merged = append(merged, Point{Raw: sorted[i].Raw, Weight: sum / float64(j-i)})
+		i = j
+	}
+
+	if len(merged) < 2 {
+		return Curve{}, ErrTooFewPoints
+	}
+
+	return Curve{Kind: Piecewise, Points: merged}, nil
+}
+
+// Weight converts net counts to a weight.
+func (c Curve) Weight(raw float64) float64 {
+	if c.Kind == Piecewise {
+		return c.interpolate(raw)
+	}
+
+	x := c.normalize(raw)
+	var w float64
+	for i := len(c.Coefficients) - 1; i >= 0; i-- {
+		w = w*x + c.Coefficients[i]
+	}
+	return w
+}
+
+// Slope returns the weight per count of the curve at raw, for a linear
+// curve this is the inverse of the classic calibration factor.
+func (c Curve) Slope(raw float64) float64 {
+	const h = 1.0
+	return (c.Weight(raw+h) - c.Weight(raw-h)) / (2 * h)
+}
+
+// Validate checks that the curve can be evaluated.
+func (c Curve) Validate() error {
+	switch c.Kind {
+	case Linear, Polynomial:
+		if c.Scale == 0 || len(c.Coefficients) < 2 {
+			return ErrSingular
+		}
+	case Piecewise:
+		if len(c.Points) < 2 {
+			return ErrTooFewPoints
+		}
+	default:
+		return ErrUnknownKind
+	}
+	return nil
+}
+
+// Residuals returns the deviation of the curve from every point.
+func (c Curve) Residuals(points []Point) []Residual {
+	res := make([]Residual, len(points))
+	for i, p := range points {
+		fitted := c.Weight(p.Raw)
+		res[i] = Residual{Point: p, Fitted: fitted, Error: fitted - p.Weight}
+	}
+	return res
+}
+
+// WriteReport prints a table of the residuals and their RMS error.
+func (c Curve) WriteReport(w io.Writer, points []Point) {
+	var sum float64
+
+	fmt.Fprintf(w, "%-12s %-12s %-12s %-12s\n", "raw", "weight", "fitted", "error")
+	for _, r := range c.Residuals(points) {
+		fmt.Fprintf(w, "%-12.0f %-12.3f %-12.3f %-+12.3f\n", r.Raw, r.Weight, r.Fitted, r.Error)
+		sum += r.Error * r.Error
+	}
+
+	if len(points) > 0 {
+		fmt.Fprintf(w, "rms error: %.3f\n", math.Sqrt(sum/float64(len(points))))
+	}
+}
+
+func (c Curve) normalize(raw float64) float64 {
+	return (raw - c.Center) / c.Scale
+}
+
+func (c Curve) interpolate(raw float64) float64 {
+	p := c.Points
+	i := sort.Search(len(p), func(i int) bool { return p[i].Raw >= raw })
+
+	// extrapolate with the first or last segment
+	if i == 0 {
+		i = 1
+	} else if i == len(p) {
+		i = len(p) - 1
+	}
+
+	a, b := p[i-1], p[i]
+	return a.Weight + (raw-a.Raw)*(b.Weight-a.Weight)/(b.Raw-a.Raw)
+}
+
+// solve solves the augmented n x n+1 system with Gaussian elimination and
+// partial pivoting.
+func solve(a [][]float64) ([]float64, error) {
+	n := len(a)
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, ErrSingular
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+
+		for row := col + 1; row < n; row++ {
+			f := a[row][col] / a[col][col]
+			for k := col; k <= n; k++ {
+				a[row][k] -= f * a[col][k]
+			}
+		}
+	}
+
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := a[row][n]
+		for k := row + 1; k < n; k++ {
+			sum -= a[row][k] * x[k]
+		}
+		x[row] = sum / a[row][row]
+	}
+
+	return x, nil
+}
+
+// Load reads a curve stored as JSON.
+func Load(path string) (*Curve, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Curve{}
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("calibration: %s: %v", path, err)
+	}
+
+	return c, c.Validate()
+}
+
+// Save writes the curve as JSON, the file is replaced atomically.
+func (c Curve) Save(path string) error {
+	return jsonfile.Save(path, c)
+}
@@ -0,0 +1,140 @@
+package calibration
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestFitPolynomial(t *testing.T) {
+	quadratic := func(raw float64) float64 { return 0.5 + 2e-3*raw + 1e-8*raw*raw }
+
+	var points []Point
+	for raw := 0.0; raw <= 200000; raw += 50000 {
+		points = append(points, Point{Raw: raw, Weight: quadratic(raw)})
+	}
+
+	c, err := FitPolynomial(points, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Center != 100000 || c.Scale != 100000 {
+		t.Errorf("normalized with center %v and scale %v, want 100000 and 100000", c.Center, c.Scale)
+	}
+	for _, raw := range []float64{-20000, 0, 12345, 99999, 200000, 250000} {
+		if got, want := c.Weight(raw), quadratic(raw); math.Abs(got-want) > 1e-6 {
+			t.Errorf("weight at %v is %v, want %v", raw, got, want)
+		}
+	}
+	if err = c.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFitPolynomialErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		degree int
+		raws   []float64
+		want   error
+	}{
+		{"no points", 1, nil, ErrTooFewPoints},
+		{"one point", 1, []float64{100}, ErrTooFewPoints},
+		{"two points for a quadratic", 2, []float64{100, 200}, ErrTooFewPoints},
+		{"degree 0", 0, []float64{100, 200}, ErrTooFewPoints},
+		{"same raw value", 1, []float64{100, 100, 100}, ErrSingular},
+		{"duplicate raw values", 2, []float64{100, 100, 200}, ErrSingular},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := make([]Point, len(tt.raws))
+			for i, raw := range tt.raws {
+				points[i] = Point{Raw: raw, Weight: float64(i)}
+			}
+			if _, err := FitPolynomial(points, tt.degree); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSolve(t *testing.T) {
+	// the first column needs a row swap
+	a := [][]float64{
+		{0, 2, 1, 7},
+		{1, 1, 1, 6},
+		{2, 1, -1, 1},
+	}
+	x, err := solve(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []float64{1, 2, 3} {
+		if math.Abs(x[i]-want) > 1e-12 {
+			t.Errorf("x[%d] = %v, want %v", i, x[i], want)
+		}
+	}
+
+	singular := [][]float64{
+		{1, 2, 3},
+		{2, 4, 6},
+	}
+	if _, err = solve(singular); !errors.Is(err, ErrSingular) {
+		t.Errorf("got %v, want %v", err, ErrSingular)
+	}
+}
+
+func TestFitPiecewise(t *testing.T) {
+	c, err := FitPiecewise([]Point{{3000, 40}, {0, 0}, {1000, 10}, {1000, 12}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		raw  float64
+		want float64
+	}{
+		{"first point", 0, 0},
+		{"averaged point", 1000, 11},
+		{"inside", 500, 5.5},
+		{"second segment", 2000, 25.5},
+		{"below the range", -1000, -11},
+		{"above the range", 4000, 54.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Weight(tt.raw); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("weight at %v is %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+
+	if _, err = FitPiecewise([]Point{{100, 1}, {100, 2}}); !errors.Is(err, ErrTooFewPoints) {
+		t.Errorf("one distinct point got %v, want %v", err, ErrTooFewPoints)
+	}
+}
+
+func TestResiduals(t *testing.T) {
+	points := []Point{{0, 0}, {1, 1}, {2, 0}}
+	c, err := Fit(Linear, 0, points)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the best line is the constant 1/3
+	want := []float64{1.0 / 3, -2.0 / 3, 1.0 / 3}
+	for i, r := range c.Residuals(points) {
+		if r.Point != points[i] || math.Abs(r.Error-want[i]) > 1e-9 || math.Abs(r.Fitted-1.0/3) > 1e-9 {
+			t.Errorf("residual %d is %+v, want an error of %v", i, r, want[i])
+		}
+	}
+
+	var report strings.Builder
+	c.WriteReport(&report, points)
+	if !strings.Contains(report.String(), "rms error: 0.471") {
+		t.Errorf("report without the rms error of 0.471:\n%s", report.String())
+	}
+}
@@ -0,0 +1,411 @@
+// Package dosing fills a container to a target weight. A Controller tares
+// the scale, feeds coarse until the switchover point, then fine, and stops
+// the feed early by the pre-act, the material still in flight. After the
+// scale settled the weight is verified, topped up if short, and the
+// overshoot is used to learn the pre-act for the next run.
+package dosing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/SimonWaldherr/rpi-examples/scale"
+)
+
+var (
+	ErrTimeout  = errors.New("dosing: timeout")
+	ErrAborted  = errors.New("dosing: aborted")
+	ErrOverfill = errors.New("dosing: overfilled")
+	ErrScale    = errors.New("dosing: too many failed reads")
+
+	// ErrStreamClosed is the end of the readings of the scale during a
+	// run, e.g. the end of a replayed recording.
+	ErrStreamClosed = errors.New("dosing: scale stream closed")
+)
+
+// Rate is the setting of the feed.
+type Rate int
+
+const (
+	Off Rate = iota
+	Fine
+	Coarse
+)
+
+func (r Rate) String() string {
+	switch r {
+	case Off:
+		return "off"
+	case Fine:
+		return "fine"
+	case Coarse:
+		return "coarse"
+	}
+	return fmt.Sprintf("Rate(%d)", int(r))
+}
+
+// Feed is the valve, gate or pump that feeds the material.
+type Feed interface {
+	Set(rate Rate) error
+}
+
+// State is the phase of a dosing run.
+type State int
+
+const (
+	Idle State = iota
+	Taring
+	CoarseFeed
+	FineFeed
+	Settling
+	Verifying
+	Done
+	Failed
+)
+
+var stateNames = []string{"idle", "taring", "coarse", "fine", "settling", "verifying", "done", "failed"}
+
+func (s State) String() string {
+	if s >= 0 && int(s) < len(stateNames) {
+		return stateNames[s]
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// Config are the parameters of a dosing run, weights are in the unit of
+// the scale calibration.
+type Config struct {
+	Target float64
+
+	// Switchover is the distance to the target where the coarse feed
+	// switches to the fine feed.
+	Switchover float64
+
+	// PreAct is the initial in-flight compensation: the fine feed stops
+	// this much before the target.
+	PreAct float64
+
+	// Learn is the share of the last deviation added to the pre-act,
+	// between 0 (fixed pre-act) and 1.
+	Learn float64
+
+	// Tolerance is the accepted deviation from the target.
+	Tolerance float64
+
+	// Settle is the time the scale gets after the feed stopped, Verify
+	// the number of readings averaged afterwards.
+	Settle time.Duration
+	Verify int
+
+	// TopUps is the number of fine feeds after a short verification.
+	TopUps int
+
+	// Timeout limits the whole run, 0 is no limit.
+	Timeout time.Duration
+
+	// TareSamples is the number of conversions for the tare.
+	TareSamples int
+
+	// MaxErrors is the number of consecutive failed reads that stops the
+	// run, readings not ready in time do not count.
+	MaxErrors int
+}
+
+// DefaultConfig returns a config for a target, the other values fit
+// targets of about 100 g on a feeder of a few g/s.
+func DefaultConfig(target float64) Config {
+	return Config{
+		Target:      target,
+		Switchover:  target * 0.1,
+		PreAct:      0,
+		Learn:       0.5,
+		Tolerance:   target * 0.01,
+		Settle:      time.Second,
+		Verify:      10,
+		TopUps:      3,
+		Timeout:     5 * time.Minute,
+		TareSamples: 10,
+		MaxErrors:   10,
+	}
+}
+
+// Validate checks that the config describes a possible run.
+func (c Config) Validate() error {
+	switch {
+	case !(c.Target > 0):
+		return fmt.Errorf("dosing: target must be positive")
+	case c.Switchover < 0 || c.Switchover > c.Target:
+		return fmt.Errorf("dosing: switchover must be between 0 and the target")
+	case c.PreAct < 0 || c.PreAct >= c.Target:
+		return fmt.Errorf("dosing: pre-act must be between 0 and the target")
+	case c.Learn < 0 || c.Learn > 1:
+		return fmt.Errorf("dosing: learn must be between 0 and 1")
+	case c.Tolerance < 0:
+		return fmt.Errorf("dosing: tolerance must not be negative")
+	case c.Verify < 1 || c.TareSamples < 1:
+		return fmt.Errorf("dosing: verify and tare samples must be positive")
+	case c.TopUps < 0 || c.MaxErrors < 1:
+		return fmt.Errorf("dosing: invalid top-ups or max errors")
+	}
+	return nil
+}
+
+// Result is the outcome of a run.
+type Result struct {
+	Target   float64
+	Actual   float64
+	PreAct   float64 // pre-act used for the run
+	Learned  float64 // pre-act for the next run
+	TopUps   int
+	Duration time.Duration
+	Err      error
+}
+
+// Deviation returns the actual minus the target weight.
+func (r Result) Deviation() float64 {
+	return r.Actual - r.Target
+}
+
+// Controller doses with a scale and a feed. The learned pre-act is kept
+// from run to run.
+type Controller struct {
+	Scale  scale.Scale
+	Feed   Feed
+	Config Config
+
+	// OnState is called on every change of the state with the net
+	// weight, if not nil.
+	OnState func(state State, weight float64)
+
+	// OnReading is called with every net weight while feeding, if not
+	// nil.
+	OnReading func(state State, weight float64)
+
+	preAct float64
+	state  State
+}
+
+// New returns a controller, the config is validated by Run.
+func New(s scale.Scale, feed Feed, cfg Config) *Controller {
+	return &Controller{Scale: s, Feed: feed, Config: cfg, preAct: cfg.PreAct}
+}
+
+// PreAct returns the pre-act of the next run.
+func (c *Controller) PreAct() float64 {
+	return c.preAct
+}
+
+// SetPreAct sets the pre-act of the next run, e.g. one learned earlier.
+func (c *Controller) SetPreAct(preAct float64) {
+	c.preAct = preAct
+}
+
+// State returns the state of the current or last run.
+func (c *Controller) State() State {
+	return c.state
+}
+
+func (c *Controller) enter(state State, weight float64) {
+	c.state = state
+	if c.OnState != nil {
+		c.OnState(state, weight)
+	}
+}
+
+// Run doses once. The feed is off when Run returns, also after a timeout,
+// an error or when ctx is cancelled, which aborts the run.
+func (c *Controller) Run(ctx context.Context) (result Result, err error) {
+	cfg := c.Config
+	start := time.Now()
+	result = Result{Target: cfg.Target, PreAct: c.preAct, Learned: c.preAct}
+
+	if err = cfg.Validate(); err != nil {
+		return result, err
+	}
+
+	defer func() {
+		if ferr := c.Feed.Set(Off); err == nil && ferr != nil {
+			err = ferr
+		}
+		if err != nil {
+			c.enter(Failed, result.Actual)
+		}
+		result.Duration = time.Since(start)
+		result.Err = err
+	}()
+
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, cfg.Timeout, ErrTimeout)
+		defer cancel()
+	}
+
+	if err = c.Feed.Set(Off); err != nil {
+		return result, err
+	}
+
+	c.enter(Taring, 0)
+	if err = c.Scale.Tare(cfg.TareSamples); err != nil {
+		return result, err
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	r := &reader{readings: c.Scale.Stream(ctx), max: cfg.MaxErrors, channel: -1}
+
+	for topUps := 0; ; topUps++ {
+		result.TopUps = topUps
+
+		if err = c.feed(ctx, r, topUps == 0); err != nil {
+			return result, cause(ctx, err)
+		}
+
+		c.enter(Settling, r.weight)
+		if err = r.wait(ctx, cfg.Settle); err != nil {
+			return result, cause(ctx, err)
+		}
+
+		c.enter(Verifying, r.weight)
+		if result.Actual, err = r.average(ctx, cfg.Verify); err != nil {
+			return result, cause(ctx, err)
+		}
+
+		if topUps == 0 {
+			// learn from the first stop only, top-ups run on a
+			// nearly full container
+			c.preAct = math.Max(0, c.preAct+cfg.Learn*result.Deviation())
+			c.preAct = math.Min(c.preAct, cfg.Switchover)
+			result.Learned = c.preAct
+		}
+
+		switch {
+		case result.Deviation() > cfg.Tolerance:
+			return result, fmt.Errorf("%w by %.3f", ErrOverfill, result.Deviation())
+		case result.Deviation() >= -cfg.Tolerance:
+			c.enter(Done, result.Actual)
+			return result, nil
+		case topUps == cfg.TopUps:
+			return result, fmt.Errorf("dosing: %.3f short after %d top-ups", -result.Deviation(), topUps)
+		}
+	}
+}
+
+// feed runs the coarse feed on the first pass and the fine feed until the
+// pre-act point.
+func (c *Controller) feed(ctx context.Context, r *reader, coarse bool) error {
+	cfg := c.Config
+	stopAt := cfg.Target - c.preAct
+
+	state, rate := FineFeed, Fine
+	if coarse && r.weight < cfg.Target-cfg.Switchover {
+		state, rate = CoarseFeed, Coarse
+	}
+	if r.weight >= stopAt {
+		// a top-up after the pre-act grew
+		stopAt = r.weight + (cfg.Target-r.weight)/2
+	}
+
+	c.enter(state, r.weight)
+	if err := c.Feed.Set(rate); err != nil {
+		return err
+	}
+
+	for {
+		if err := r.next(ctx); err != nil {
+			return err
+		}
+		if c.OnReading != nil {
+			c.OnReading(c.state, r.weight)
+		}
+
+		switch {
+		case r.weight >= stopAt:
+			return c.Feed.Set(Off)
+		case c.state == CoarseFeed && r.weight >= cfg.Target-cfg.Switchover:
+			c.enter(FineFeed, r.weight)
+			if err := c.Feed.Set(Fine); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// cause returns the reason a run ended early.
+func cause(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(context.Cause(ctx), ErrTimeout):
+		return ErrTimeout
+	case ctx.Err() != nil:
+		return ErrAborted
+	}
+	return err
+}
+
+// reader follows the stream of the scale, weight is the last net weight.
+// Of a scale reading two load cells it follows the first channel seen.
+type reader struct {
+	readings <-chan scale.Reading
+	weight   float64
+	failed   int
+	max      int
+	channel  int
+}
+
+func (r *reader) next(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case reading, ok := <-r.readings:
+			if !ok {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				return ErrStreamClosed
+			}
+			if r.channel < 0 {
+				r.channel = reading.Channel
+			}
+			if reading.Channel != r.channel {
+				continue
+			}
+			switch {
+			case reading.Err == nil:
+				r.failed = 0
+				r.weight = reading.Weight
+				return nil
+			case errors.Is(reading.Err, scale.ErrNotReady):
+			default:
+				if r.failed++; r.failed >= r.max {
+					return fmt.Errorf("%w: %v", ErrScale, reading.Err)
+				}
+			}
+		}
+	}
+}
+
+// wait follows the scale for d.
+func (r *reader) wait(ctx context.Context, d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) {
+		if err := r.next(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// average returns the mean of the next n readings.
+func (r *reader) average(ctx context.Context, n int) (float64, error) {
+	var sum float64
+	for i := 0; i < n; i++ {
+		if err := r.next(ctx); err != nil {
+			return 0, err
+		}
+		sum += r.weight
+	}
+	return sum / float64(n), nil
+}
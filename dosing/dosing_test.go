@@ -0,0 +1,206 @@
+package dosing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/SimonWaldherr/rpi-examples/scale"
+)
+
+// closing is a simulated scale whose stream ends after a number of
+// readings, like the replay of a recording.
+type closing struct {
+	*Sim
+	readings int
+}
+
+func (c *closing) Stream(ctx context.Context) <-chan scale.Reading {
+	ch := make(chan scale.Reading)
+	readings := c.Sim.Stream(ctx)
+
+	go func() {
+		defer close(ch)
+
+		for i := 0; i < c.readings; i++ {
+			r, ok := <-readings
+			if !ok {
+				return
+			}
+			select {
+			case ch <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+func TestRunStreamClosed(t *testing.T) {
+	tests := []struct {
+		name     string
+		readings int
+		timeout  time.Duration
+	}{
+		{"no readings", 0, 0},
+		{"while feeding", 10, 0},
+		{"with a timeout", 10, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := NewSim()
+			cfg := DefaultConfig(100)
+			cfg.Timeout = tt.timeout
+			c := New(&closing{Sim: sim, readings: tt.readings}, sim, cfg)
+
+			start := time.Now()
+			_, err := c.Run(context.Background())
+			if !errors.Is(err, ErrStreamClosed) {
+				t.Fatalf("got %v, want %v", err, ErrStreamClosed)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("took %v to notice the closed stream", elapsed)
+			}
+			if c.State() != Failed {
+				t.Errorf("state %v, want %v", c.State(), Failed)
+			}
+		})
+	}
+}
+
+// feedStopped reports whether no more material lands on the simulated
+// scale once the material in flight arrived.
+func feedStopped(sim *Sim) error {
+	time.Sleep(sim.Fall + 50*time.Millisecond)
+	before := sim.Landed()
+	time.Sleep(100 * time.Millisecond)
+	if after := sim.Landed(); after != before {
+		return fmt.Errorf("feed still running: %.3f -> %.3f", before, after)
+	}
+	return nil
+}
+
+// fastSim returns a feeder ten times faster than NewSim, a run of 100 takes
+// about half a second.
+func fastSim() *Sim {
+	sim := NewSim()
+	sim.CoarseFlow *= 10
+	sim.FineFlow *= 10
+	sim.Fall /= 10
+	sim.Interval /= 10
+	return sim
+}
+
+// TestRun doses with the simulated scale and valve through the simulated
+// output chips.
+func TestRun(t *testing.T) {
+	feeds := map[string]func(t *testing.T, sim *Sim) Feed{
+		"pcf8574": func(t *testing.T, sim *Sim) Feed {
+			feed, _ := pcf8574Feed(t, sim)
+			return feed
+		},
+		"pca9685": func(t *testing.T, sim *Sim) Feed {
+			feed, _ := pca9685Feed(t, sim)
+			return feed
+		},
+	}
+
+	tests := []struct {
+		name   string
+		output string
+		run    func(c *Controller, sim *Sim) error
+	}{
+		{"dose and learn the pre-act", "pcf8574", func(c *Controller, sim *Sim) error {
+			// without a pre-act the material in flight lands on top of
+			// the target, the first run may overfill
+			first, err := c.Run(context.Background())
+			if err != nil && !errors.Is(err, ErrOverfill) {
+				return err
+			}
+			if first.Deviation() <= 0 || c.PreAct() <= 0 {
+				return fmt.Errorf("first run %+.2f without a pre-act learned %.2f from the material in flight", first.Deviation(), c.PreAct())
+			}
+
+			for i := 2; i <= 4; i++ {
+				sim.Empty()
+				result, err := c.Run(context.Background())
+				if err != nil {
+					return fmt.Errorf("run %d: %v", i, err)
+				}
+				if math.Abs(result.Deviation()) > c.Config.Tolerance {
+					return fmt.Errorf("run %d: %+.2f outside the tolerance", i, result.Deviation())
+				}
+			}
+			return nil
+		}},
+		{"pca9685 output", "pca9685", func(c *Controller, sim *Sim) error {
+			c.SetPreAct(0.8)
+			_, err := c.Run(context.Background())
+			return err
+		}},
+		{"top up a short run", "pcf8574", func(c *Controller, sim *Sim) error {
+			c.Config.Learn = 0
+			c.SetPreAct(c.Config.Switchover)
+			result, err := c.Run(context.Background())
+			if err != nil {
+				return err
+			}
+			if result.TopUps == 0 {
+				return fmt.Errorf("no top-up with a pre-act of %.2f", result.PreAct)
+			}
+			return nil
+		}},
+		{"overfill", "pcf8574", func(c *Controller, sim *Sim) error {
+			sim.Fall = 100 * time.Millisecond
+			c.Config.Learn = 0
+			if _, err := c.Run(context.Background()); !errors.Is(err, ErrOverfill) {
+				return fmt.Errorf("got %v, want %v", err, ErrOverfill)
+			}
+			if c.State() != Failed {
+				return fmt.Errorf("state %v", c.State())
+			}
+			return nil
+		}},
+		{"timeout", "pcf8574", func(c *Controller, sim *Sim) error {
+			c.Config.Timeout = 50 * time.Millisecond
+			if _, err := c.Run(context.Background()); !errors.Is(err, ErrTimeout) {
+				return fmt.Errorf("got %v, want %v", err, ErrTimeout)
+			}
+			return nil
+		}},
+		{"abort", "pca9685", func(c *Controller, sim *Sim) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if _, err := c.Run(ctx); !errors.Is(err, ErrAborted) {
+				return fmt.Errorf("got %v, want %v", err, ErrAborted)
+			}
+			return nil
+		}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := DefaultConfig(100)
+			cfg.Settle = 30 * time.Millisecond
+			cfg.Timeout = 5 * time.Second
+
+			sim := fastSim()
+			c := New(sim, feeds[tt.output](t, sim), cfg)
+			if err := tt.run(c, sim); err != nil {
+				t.Fatal(err)
+			}
+			if err := feedStopped(sim); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
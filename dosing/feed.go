@@ -0,0 +1,112 @@
+package dosing
+
+import "fmt"
+
+// Writer is a connection to a PCF8574, *i2c.Device and *i2csim.Conn
+// implement it.
+type Writer interface {
+	Write(buf []byte) error
+}
+
+// PCF8574Feed switches the feed with two relays on a PCF8574, one for the
+// coarse and one for the fine feed. The other pins stay high. Most relay
+// boards switch on a low pin, set ActiveHigh otherwise.
+type PCF8574Feed struct {
+	Dev        Writer
+	CoarseBit  uint
+	FineBit    uint
+	ActiveHigh bool
+	// Both keeps the fine relay on during the coarse feed, for a fine
+	// valve in parallel to the coarse one.
+	Both bool
+}
+
+func (f *PCF8574Feed) Set(rate Rate) error {
+	var on byte
+	switch rate {
+	case Off:
+	case Fine:
+		on = 1 << f.FineBit
+	case Coarse:
+		on = 1 << f.CoarseBit
+		if f.Both {
+			on |= 1 << f.FineBit
+		}
+	default:
+		return fmt.Errorf("dosing: invalid rate %v", rate)
+	}
+
+	port := 0xFF &^ on
+	if f.ActiveHigh {
+		port = 0xFF&^(1<<f.CoarseBit|1<<f.FineBit) | on
+	}
+	return f.Dev.Write([]byte{port})
+}
+
+// PCA9685 registers used by PCA9685Feed.
+const (
+	pca9685Mode1     = 0x00
+	pca9685Led0OnL   = 0x06
+	pca9685Mode1AI   = 1 << 5
+	pca9685FullOnOff = 1 << 4
+)
+
+// RegisterWriter is a connection to a PCA9685, *i2c.Device and
+// *i2csim.Conn implement it.
+type RegisterWriter interface {
+	WriteReg(reg byte, buf []byte) error
+}
+
+// PCA9685Feed drives a proportional valve or a pump on one channel of a
+// PCA9685 with a duty cycle for each rate.
+type PCA9685Feed struct {
+	Dev        RegisterWriter
+	Channel    int
+	CoarseDuty float64
+	FineDuty   float64
+}
+
+// NewPCA9685Feed wakes the controller up with register auto-increment and
+// turns the channel off.
+func NewPCA9685Feed(dev RegisterWriter, channel int, coarseDuty, fineDuty float64) (*PCA9685Feed, error) {
+	if channel < 0 || channel > 15 {
+		return nil, fmt.Errorf("dosing: invalid pca9685 channel %d", channel)
+	}
+	for _, d := range []float64{coarseDuty, fineDuty} {
+		if d < 0 || d > 1 {
+			return nil, fmt.Errorf("dosing: duty cycle %v out of 0..1", d)
+		}
+	}
+
+	f := &PCA9685Feed{Dev: dev, Channel: channel, CoarseDuty: coarseDuty, FineDuty: fineDuty}
+	if err := dev.WriteReg(pca9685Mode1, []byte{pca9685Mode1AI}); err != nil {
+		return nil, err
+	}
+	return f, f.Set(Off)
+}
+
+func (f *PCA9685Feed) Set(rate Rate) error {
+	var duty float64
+	switch rate {
+	case Off:
+	case Fine:
+		duty = f.FineDuty
+	case Coarse:
+		duty = f.CoarseDuty
+	default:
+		return fmt.Errorf("dosing: invalid rate %v", rate)
+	}
+
+	// ON_L, ON_H, OFF_L, OFF_H with the full on and full off bits for the
+	// ends of the range
+	var regs [4]byte
+	switch off := int(duty*4096 + 0.5); {
+	case off <= 0:
+		regs[3] = pca9685FullOnOff
+	case off >= 4096:
+		regs[1] = pca9685FullOnOff
+	default:
+		regs[2], regs[3] = byte(off), byte(off>>8)
+	}
+	return f.Dev.WriteReg(byte(pca9685Led0OnL+4*f.Channel), regs[:])
+}
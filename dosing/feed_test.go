@@ -0,0 +1,101 @@
+package dosing
+
+import (
+	"testing"
+
+	"github.com/SimonWaldherr/rpi-examples/i2csim"
+)
+
+// pcf8574Feed returns relays on a simulated PCF8574, pin 0 for the coarse
+// and pin 1 for the fine feed, that switch the valve of sim.
+func pcf8574Feed(t *testing.T, sim *Sim) (*PCF8574Feed, *i2csim.PCF8574) {
+	t.Helper()
+
+	bus := i2csim.NewBus()
+	expander := i2csim.NewPCF8574()
+	expander.OnWrite = func(port byte) {
+		switch {
+		case port&1 == 0:
+			sim.Set(Coarse)
+		case port&2 == 0:
+			sim.Set(Fine)
+		default:
+			sim.Set(Off)
+		}
+	}
+	bus.Attach(0x20, expander)
+	conn, err := bus.Open(0x20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &PCF8574Feed{Dev: conn, CoarseBit: 0, FineBit: 1}, expander
+}
+
+// pca9685Feed returns channel 0 of a simulated PCA9685 with a coarse duty
+// of 1 and a fine duty of 0.25 that drives the valve of sim.
+func pca9685Feed(t *testing.T, sim *Sim) (*PCA9685Feed, *i2csim.PCA9685) {
+	t.Helper()
+
+	bus := i2csim.NewBus()
+	controller := i2csim.NewPCA9685()
+	bus.Attach(0x40, controller)
+	conn, err := bus.Open(0x40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, err := NewPCA9685Feed(&SimValve{Conn: conn, PWM: controller, Sim: sim, FineDuty: 0.25}, 0, 1, 0.25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed, controller
+}
+
+func TestPCF8574Feed(t *testing.T) {
+	tests := []struct {
+		rate       Rate
+		activeHigh bool
+		both       bool
+		port       byte
+	}{
+		{Off, false, false, 0xFF},
+		{Coarse, false, false, 0xFE},
+		{Fine, false, false, 0xFD},
+		{Coarse, false, true, 0xFC},
+		{Off, true, false, 0xFC},
+		{Coarse, true, false, 0xFD},
+		{Fine, true, false, 0xFE},
+	}
+
+	for _, tt := range tests {
+		feed, expander := pcf8574Feed(t, NewSim())
+		feed.ActiveHigh, feed.Both = tt.activeHigh, tt.both
+
+		if err := feed.Set(tt.rate); err != nil {
+			t.Fatal(err)
+		}
+		if port := expander.Port(); port != tt.port {
+			t.Errorf("%v with active high %v and both %v: port %08b, want %08b", tt.rate, tt.activeHigh, tt.both, port, tt.port)
+		}
+	}
+}
+
+func TestPCA9685Feed(t *testing.T) {
+	tests := []struct {
+		rate Rate
+		duty float64
+	}{
+		{Coarse, 1},
+		{Fine, 0.25},
+		{Off, 0},
+	}
+
+	feed, controller := pca9685Feed(t, NewSim())
+	for _, tt := range tests {
+		if err := feed.Set(tt.rate); err != nil {
+			t.Fatal(err)
+		}
+		if duty := controller.Duty(0); duty != tt.duty {
+			t.Errorf("%v: duty %v, want %v", tt.rate, duty, tt.duty)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package dosing
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/SimonWaldherr/rpi-examples/i2csim"
+	"github.com/SimonWaldherr/rpi-examples/scale"
+)
+
+// Sim simulates a feeder above a scale. It is the Feed and the Scale of a
+// controller at the same time: material leaves the valve at the flow of
+// the rate set and lands on the scale after Fall, which is the in-flight
+// material the pre-act has to account for.
+type Sim struct {
+	CoarseFlow float64 // units per second
+	FineFlow   float64
+	Fall       time.Duration
+
+	// Counts is the raw change of the simulated ADC per unit, Noise its
+	// standard deviation in counts.
+	Counts float64
+	Noise  float64
+
+	// Interval is the time between two conversions.
+	Interval time.Duration
+
+	mu      sync.Mutex
+	start   time.Time
+	changes []change
+	cal     scale.Calibration
+	counts  scale.ErrorCounts
+}
+
+// change is a setting of the valve from time t on.
+type change struct {
+	t    time.Duration
+	flow float64
+}
+
+// NewSim returns a feeder with a coarse flow of 40 and a fine flow of 4
+// units per second and 150 ms of fall, converted at 80 Hz.
+func NewSim() *Sim {
+	return &Sim{
+		CoarseFlow: 40,
+		FineFlow:   4,
+		Fall:       150 * time.Millisecond,
+		Counts:     100,
+		Noise:      5,
+		Interval:   time.Second / 80,
+		start:      time.Now(),
+		cal:        scale.Calibration{Factor: 100},
+	}
+}
+
+// Set implements Feed.
+func (s *Sim) Set(rate Rate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	flow := 0.0
+	switch rate {
+	case Fine:
+		flow = s.FineFlow
+	case Coarse:
+		flow = s.CoarseFlow
+	}
+	s.changes = append(s.changes, change{t: time.Since(s.start), flow: flow})
+	return nil
+}
+
+// Empty removes everything from the scale and starts over, e.g. for the
+// next container.
+func (s *Sim) Empty() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.start = time.Now()
+	s.changes = nil
+}
+
+// Landed returns the material on the scale.
+func (s *Sim) Landed() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.landed(time.Since(s.start))
+}
+
+// landed integrates the flow delayed by Fall up to t.
+func (s *Sim) landed(t time.Duration) float64 {
+	total := 0.0
+	for i, c := range s.changes {
+		from := c.t + s.Fall
+		to := t
+		if i+1 < len(s.changes) && s.changes[i+1].t+s.Fall < to {
+			to = s.changes[i+1].t + s.Fall
+		}
+		if to > from {
+			total += c.flow * (to - from).Seconds()
+		}
+	}
+	return total
+}
+
+func (s *Sim) raw() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counts.Reads++
+	return int(s.landed(time.Since(s.start))*s.Counts + rand.NormFloat64()*s.Noise)
+}
+
+func (s *Sim) ReadRaw(samples int) (int, error) {
+	if samples < 1 {
+		return 0, scale.ErrInvalidSampleCount
+	}
+
+	sum := 0
+	for i := 0; i < samples; i++ {
+		time.Sleep(s.Interval)
+		sum += s.raw()
+	}
+	return sum / samples, nil
+}
+
+func (s *Sim) ReadWeight(samples int) (float64, error) {
+	raw, err := s.ReadRaw(samples)
+	return s.GetCalibration().Weight(raw), err
+}
+
+func (s *Sim) Tare(samples int) error {
+	raw, err := s.ReadRaw(samples)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cal.Zero = raw
+	return nil
+}
+
+func (s *Sim) Calibrate(knownWeight float64, samples int) error {
+	raw, err := s.ReadRaw(samples)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cal = scale.Calibration{Zero: s.cal.Zero, Factor: float64(raw-s.cal.Zero) / knownWeight}
+	return nil
+}
+
+func (s *Sim) GetCalibration() scale.Calibration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cal
+}
+
+func (s *Sim) SetCalibration(c scale.Calibration) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cal = c
+	return nil
+}
+
+func (s *Sim) Stream(ctx context.Context) <-chan scale.Reading {
+	ch := make(chan scale.Reading, 16)
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				raw := s.raw()
+				r := scale.Reading{Time: now, Raw: raw, Weight: s.GetCalibration().Weight(raw)}
+				select {
+				case ch <- r:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
+func (s *Sim) GetErrorCounts() scale.ErrorCounts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.counts
+}
+
+func (s *Sim) ResetErrorCounts() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counts = scale.ErrorCounts{}
+}
+
+func (s *Sim) Close() error {
+	return nil
+}
+
+// SimValve is a valve driven by a channel of a simulated PCA9685, it is
+// the RegisterWriter of a PCA9685Feed. The register writes are passed to
+// the PCA9685 on Conn, then the valve of Sim follows the duty cycle of
+// Channel: off at 0, the fine feed up to FineDuty and the coarse feed
+// above.
+type SimValve struct {
+	Conn     *i2csim.Conn
+	PWM      *i2csim.PCA9685
+	Sim      *Sim
+	Channel  int
+	FineDuty float64
+}
+
+func (v *SimValve) WriteReg(reg byte, buf []byte) error {
+	if err := v.Conn.WriteReg(reg, buf); err != nil {
+		return err
+	}
+
+	switch duty := v.PWM.Duty(v.Channel); {
+	case duty == 0:
+		v.Sim.Set(Off)
+	case duty > v.FineDuty:
+		v.Sim.Set(Coarse)
+	default:
+		v.Sim.Set(Fine)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package dosing
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/SimonWaldherr/rpi-examples/scale"
+)
+
+// TestTaredSim tares the simulated scale with a container of a preset tare
+// on it, like dose -tare does before a run.
+func TestTaredSim(t *testing.T) {
+	const container = 50.0
+
+	sim := NewSim()
+	// the container is on the scale
+	if err := sim.SetCalibration(scale.Calibration{Zero: -int(container * sim.Counts), Factor: sim.Counts}); err != nil {
+		t.Fatal(err)
+	}
+
+	tared := scale.NewTared(sim, nil, "")
+	if err := tared.PresetTare(container); err != nil {
+		t.Fatal(err)
+	}
+	if err := tared.Tare(10); err != nil {
+		t.Fatal(err)
+	}
+
+	if tare, _ := tared.GetTare(); tare != 0 {
+		t.Errorf("tare %v after zeroing the scale, want 0", tare)
+	}
+
+	net, err := tared.ReadWeight(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(net) > 0.5 {
+		t.Errorf("ReadWeight got a net of %.2f after the tare, want 0", net)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := <-tared.Stream(ctx)
+	if math.Abs(r.Net) > 0.5 || r.Weight != r.Net {
+		t.Errorf("stream got a net of %.2f and a weight of %.2f after the tare, want 0", r.Net, r.Weight)
+	}
+}
@@ -0,0 +1,321 @@
+// Package filter smooths the readings of a scale. Filters process one
+// value at a time and are combined into a Chain, which is written as a
+// comma separated list of filters with their parameters:
+//
+//	median:N      median of the last N values
+//	avg:N         mean of the last N values
+//	ema:ALPHA     exponential smoothing, 0 < ALPHA <= 1
+//	kalman:Q:R    1-D Kalman filter with process noise Q and measurement
+//	              noise R (variances)
+//	mad:N:K       drops values more than K scaled median absolute
+//	              deviations away from the median of the last N values
+//
+// e.g. "mad:9:3.5,median:5,ema:0.2".
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrOutlier is the reason a value was dropped by the outlier rejection.
+var ErrOutlier = errors.New("filter: outlier")
+
+// Filter processes a sequence of values. Next returns the filtered value,
+// ok is false if the value was dropped.
+type Filter interface {
+	Next(x float64) (y float64, ok bool)
+	Reset()
+	String() string
+}
+
+// window keeps the last n values.
+type window struct {
+	n      int
+	values []float64
+}
+
+func (w *window) add(x float64) {
+	if w.values = append(w.values, x); len(w.values) > w.n {
+		w.values = w.values[1:]
+	}
+}
+
+func (w *window) Reset() {
+	w.values = nil
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	m := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[m-1] + sorted[m]) / 2
+	}
+	return sorted[m]
+}
+
+// Median returns the median of the last N values.
+type Median struct {
+	window
+}
+
+func NewMedian(n int) *Median {
+	return &Median{window{n: n}}
+}
+
+func (m *Median) Next(x float64) (float64, bool) {
+	m.add(x)
+	return median(m.values), true
+}
+
+func (m *Median) String() string {
+	return fmt.Sprintf("median:%d", m.n)
+}
+
+// MovingAverage returns the mean of the last N values.
+type MovingAverage struct {
+	window
+}
+
+func NewMovingAverage(n int) *MovingAverage {
+	return &MovingAverage{window{n: n}}
+}
+
+func (a *MovingAverage) Next(x float64) (float64, bool) {
+	a.add(x)
+
+	sum := 0.0
+	for _, v := range a.values {
+		sum += v
+	}
+	return sum / float64(len(a.values)), true
+}
+
+func (a *MovingAverage) String() string {
+	return fmt.Sprintf("avg:%d", a.n)
+}
+
+// EMA is exponential smoothing, it starts at the first value.
+type EMA struct {
+	Alpha float64
+	y     float64
+	init  bool
+}
+
+func NewEMA(alpha float64) *EMA {
+	return &EMA{Alpha: alpha}
+}
+
+func (e *EMA) Next(x float64) (float64, bool) {
+	if !e.init {
+		e.y, e.init = x, true
+	} else {
+		e.y += e.Alpha * (x - e.y)
+	}
+	return e.y, true
+}
+
+func (e *EMA) Reset() {
+	e.init = false
+}
+
+func (e *EMA) String() string {
+	return fmt.Sprintf("ema:%v", e.Alpha)
+}
+
+// Kalman is a 1-D Kalman filter for a constant value, Q is the variance
+// the weight changes by between two readings and R the variance of the
+// readings. A small Q/R smooths more and follows changes slower.
+type Kalman struct {
+	Q, R float64
+	x, p float64
+	init bool
+}
+
+func NewKalman(q, r float64) *Kalman {
+	return &Kalman{Q: q, R: r}
+}
+
+func (k *Kalman) Next(z float64) (float64, bool) {
+	if !k.init {
+		k.x, k.p, k.init = z, k.R, true
+		return k.x, true
+	}
+
+	k.p += k.Q
+	gain := k.p / (k.p + k.R)
+	k.x += gain * (z - k.x)
+	k.p *= 1 - gain
+	return k.x, true
+}
+
+func (k *Kalman) Reset() {
+	k.init = false
+}
+
+func (k *Kalman) String() string {
+	return fmt.Sprintf("kalman:%v:%v", k.Q, k.R)
+}
+
+// madScale makes the median absolute deviation an estimate of the
+// standard deviation of normally distributed values.
+const madScale = 1.4826
+
+// Outlier drops values more than K scaled median absolute deviations
+// from the median of the last N values. Dropped values stay in the window,
+// so a real change of the weight passes once it makes up half of it.
+type Outlier struct {
+	window
+	K float64
+}
+
+func NewOutlier(n int, k float64) *Outlier {
+	return &Outlier{window: window{n: n}, K: k}
+}
+
+func (o *Outlier) Next(x float64) (float64, bool) {
+	o.add(x)
+	if len(o.values) < 3 {
+		return x, true
+	}
+
+	m := median(o.values)
+	deviations := make([]float64, len(o.values))
+	for i, v := range o.values {
+		deviations[i] = math.Abs(v - m)
+	}
+	mad := madScale * median(deviations)
+
+	if mad > 0 && math.Abs(x-m) > o.K*mad {
+		return m, false
+	}
+	return x, true
+}
+
+func (o *Outlier) String() string {
+	return fmt.Sprintf("mad:%d:%v", o.n, o.K)
+}
+
+// Chain runs the filters in order. A value dropped by one filter does not
+// reach the following ones.
+type Chain []Filter
+
+func (c Chain) Next(x float64) (float64, bool) {
+	for _, f := range c {
+		var ok bool
+		if x, ok = f.Next(x); !ok {
+			return x, false
+		}
+	}
+	return x, true
+}
+
+func (c Chain) Reset() {
+	for _, f := range c {
+		f.Reset()
+	}
+}
+
+func (c Chain) String() string {
+	specs := make([]string, len(c))
+	for i, f := range c {
+		specs[i] = f.String()
+	}
+	return strings.Join(specs, ",")
+}
+
+// Parse builds a chain from its description, an empty one passes the
+// values unchanged.
+func Parse(spec string) (Chain, error) {
+	var chain Chain
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		fields := strings.Split(part, ":")
+		params := make([]float64, len(fields)-1)
+		for i, field := range fields[1:] {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("filter: %q: invalid parameter %q", part, field)
+			}
+			params[i] = v
+		}
+
+		f, err := build(fields[0], params)
+		if err != nil {
+			return nil, fmt.Errorf("filter: %q: %v", part, err)
+		}
+		chain = append(chain, f)
+	}
+
+	return chain, nil
+}
+
+func build(name string, p []float64) (Filter, error) {
+	count := func(n int) error {
+		if len(p) != n {
+			return fmt.Errorf("%s takes %d parameters", name, n)
+		}
+		return nil
+	}
+	size := func(v float64) (int, error) {
+		if v < 1 || v != math.Trunc(v) {
+			return 0, fmt.Errorf("window must be a positive integer")
+		}
+		return int(v), nil
+	}
+
+	switch name {
+	case "median", "avg":
+		if err := count(1); err != nil {
+			return nil, err
+		}
+		n, err := size(p[0])
+		if err != nil {
+			return nil, err
+		}
+		if name == "median" {
+			return NewMedian(n), nil
+		}
+		return NewMovingAverage(n), nil
+	case "ema":
+		if err := count(1); err != nil {
+			return nil, err
+		}
+		if !(p[0] > 0 && p[0] <= 1) {
+			return nil, fmt.Errorf("alpha must be in (0, 1]")
+		}
+		return NewEMA(p[0]), nil
+	case "kalman":
+		if err := count(2); err != nil {
+			return nil, err
+		}
+		if !(p[0] > 0 && p[1] > 0) {
+			return nil, fmt.Errorf("variances must be positive")
+		}
+		return NewKalman(p[0], p[1]), nil
+	case "mad":
+		if err := count(2); err != nil {
+			return nil, err
+		}
+		n, err := size(p[0])
+		if err != nil {
+			return nil, err
+		}
+		if !(p[1] > 0) {
+			return nil, fmt.Errorf("threshold must be positive")
+		}
+		return NewOutlier(n, p[1]), nil
+	}
+	return nil, fmt.Errorf("unknown filter %q", name)
+}
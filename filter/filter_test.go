@@ -0,0 +1,140 @@
+package filter
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWindows(t *testing.T) {
+	in := []float64{1, 5, 2, 8, 3}
+
+	tests := []struct {
+		filter Filter
+		want   []float64
+	}{
+		{NewMedian(3), []float64{1, 3, 2, 5, 3}},
+		{NewMovingAverage(3), []float64{1, 3, 8.0 / 3, 5, 13.0 / 3}},
+		{NewMedian(1), in},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter.String(), func(t *testing.T) {
+			for i, x := range in {
+				y, ok := tt.filter.Next(x)
+				if !ok || math.Abs(y-tt.want[i]) > 1e-9 {
+					t.Errorf("value %d: got %v %v, want %v true", i, y, ok, tt.want[i])
+				}
+			}
+
+			tt.filter.Reset()
+			if y, _ := tt.filter.Next(7); y != 7 {
+				t.Errorf("first value after Reset got %v, want 7", y)
+			}
+		})
+	}
+}
+
+// TestStep runs the smoothing filters over a step from 0 to 10, they lag
+// behind it at first and reach it in the end.
+func TestStep(t *testing.T) {
+	tests := []Filter{
+		NewEMA(0.2),
+		NewKalman(0.01, 1),
+		NewMovingAverage(5),
+	}
+
+	for _, f := range tests {
+		t.Run(f.String(), func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				if y, _ := f.Next(0); y != 0 {
+					t.Fatalf("got %v before the step, want 0", y)
+				}
+			}
+
+			y, _ := f.Next(10)
+			if !(y > 0 && y < 10) {
+				t.Errorf("got %v at the step, want a value between 0 and 10", y)
+			}
+			for i := 0; i < 200; i++ {
+				y, _ = f.Next(10)
+			}
+			if math.Abs(y-10) > 0.01 {
+				t.Errorf("got %v after the step, want 10", y)
+			}
+		})
+	}
+}
+
+func TestOutlier(t *testing.T) {
+	chain, err := Parse("mad:5:3.5,median:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, x := range []float64{10, 10.1, 9.9, 10, 10.1} {
+		if _, ok := chain.Next(x); !ok {
+			t.Fatalf("%v dropped", x)
+		}
+	}
+
+	y, ok := chain.Next(100)
+	if ok || y == 100 {
+		t.Errorf("spike got %v %v, want it dropped", y, ok)
+	}
+	if y, _ = chain.Next(10); math.Abs(y-10) > 0.1 {
+		t.Errorf("got %v after the spike, want about 10", y)
+	}
+
+	// a real change passes once it makes up half of the window
+	passed := 0
+	for i := 0; i < 5; i++ {
+		if _, ok := chain[0].Next(50); ok {
+			passed++
+		}
+	}
+	if passed == 0 {
+		t.Errorf("a change of the weight never passed")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string // "" for an error
+	}{
+		{"", ""},
+		{"mad:9:3.5, median:5 ,ema:0.2", "mad:9:3.5,median:5,ema:0.2"},
+		{"avg:4,kalman:0.01:1", "avg:4,kalman:0.01:1"},
+		{"median", ""},
+		{"median:0", ""},
+		{"median:2.5", ""},
+		{"avg:x", ""},
+		{"ema:0", ""},
+		{"ema:1.5", ""},
+		{"kalman:1", ""},
+		{"kalman:0:1", ""},
+		{"mad:9", ""},
+		{"mad:9:0", ""},
+		{"lowpass:3", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			chain, err := Parse(tt.spec)
+			switch {
+			case tt.want == "" && tt.spec == "":
+				if err != nil || len(chain) != 0 {
+					t.Errorf("got %v %v, want an empty chain", chain, err)
+				}
+			case tt.want == "":
+				if err == nil {
+					t.Errorf("got %v, want an error", chain)
+				}
+			case err != nil:
+				t.Errorf("got %v", err)
+			case chain.String() != tt.want:
+				t.Errorf("got %q, want %q", chain.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+// replay runs recorded weights through candidate filter chains and reports
+// their noise and how fast they follow a step.
+//
+//	replay [-input samples.txt|recording] [-rate 80] [-quiet 200] [CHAIN ...]
+//
+// The input is a recording of -record or has one sample per line, either
+// "weight" or "seconds weight", lines starting with # are skipped. It
+// should start and end with a quiet segment and have the step, e.g. a
+// weight put on the scale, in between. Without -input a step with noise
+// and spikes is generated.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/SimonWaldherr/rpi-examples/filter"
+	"github.com/SimonWaldherr/rpi-examples/scale"
+)
+
+var input string
+var rate float64
+var quiet int
+
+// sample is a recorded weight at t seconds.
+type sample struct {
+	t      float64
+	weight float64
+}
+
+func load(r io.Reader) ([]sample, error) {
+	var samples []sample
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		values := make([]float64, len(fields))
+		for i, field := range fields {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			values[i] = v
+		}
+
+		switch len(values) {
+		case 1:
+			samples = append(samples, sample{t: float64(len(samples)) / rate, weight: values[0]})
+		case 2:
+			samples = append(samples, sample{t: values[0], weight: values[1]})
+		default:
+			return nil, fmt.Errorf("line %d: want \"weight\" or \"seconds weight\"", line)
+		}
+	}
+
+	return samples, scanner.Err()
+}
+
+// loadRecording returns the weights of the first channel of the streams of
+// a recording, failed reads are left out.
+func loadRecording(rec *scale.RecordingReader) ([]sample, error) {
+	var samples []sample
+
+	channel := -1
+	for {
+		r, err := rec.Next()
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.Calibration != nil || r.Stream || r.Read || r.Err != nil {
+			continue
+		}
+		if channel < 0 {
+			channel = r.Channel
+		}
+		if r.Channel == channel {
+			samples = append(samples, sample{t: r.Time.Sub(rec.Header.Time).Seconds(), weight: r.Weight})
+		}
+	}
+}
+
+// generate returns 2*quiet samples of a 100 unit step with a noise of 1
+// and a spike of 30 every 50 samples.
+func generate() []sample {
+	samples := make([]sample, 2*quiet)
+	for i := range samples {
+		w := rand.NormFloat64()
+		if i >= quiet {
+			w += 100
+		}
+		if i%50 == 25 {
+			w += 30
+		}
+		samples[i] = sample{t: float64(i) / rate, weight: w}
+	}
+	return samples
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
+
+func stddev(values []float64) float64 {
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	sum := 0.0
+	for _, v := range values {
+		sum += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sum / float64(len(values)))
+}
+
+// result of one chain.
+type result struct {
+	chain     string
+	noise     float64
+	latency   int // samples, -1 if the output never reached 90% of the step
+	seconds   float64
+	overshoot float64
+	dropped   int
+}
+
+// evaluate runs the samples through chain. The step goes from the median
+// of the first quiet samples to the median of the last ones and starts
+// where the input crosses the middle of both; the latency ends where the
+// output reaches 90% of the step.
+func evaluate(samples []sample, chain filter.Chain) result {
+	res := result{chain: chain.String(), latency: -1}
+	if res.chain == "" {
+		res.chain = "raw"
+	}
+
+	in := make([]float64, len(samples))
+	out := make([]float64, len(samples))
+	last := samples[0].weight
+	for i, s := range samples {
+		in[i] = s.weight
+		y, ok := chain.Next(s.weight)
+		if !ok {
+			res.dropped++
+			y = last
+		}
+		out[i], last = y, y
+	}
+
+	before := median(in[:quiet])
+	after := median(in[len(in)-quiet:])
+	step := after - before
+	sign := 1.0
+	if step < 0 {
+		sign = -1
+	}
+
+	res.noise = stddev(out[:quiet])
+
+	start := -1
+	for i := quiet; i < len(in); i++ {
+		if sign*(in[i]-before) >= sign*step/2 {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return res
+	}
+
+	peak := before
+	for i := start; i < len(out); i++ {
+		if res.latency < 0 && sign*(out[i]-before) >= sign*step*0.9 {
+			res.latency = i - start
+			res.seconds = samples[i].t - samples[start].t
+		}
+		if sign*(out[i]-peak) > 0 {
+			peak = out[i]
+		}
+	}
+	if step != 0 {
+		res.overshoot = math.Max(0, sign*(peak-after)/math.Abs(step)*100)
+	}
+
+	return res
+}
+
+func main() {
+	flag.StringVar(&input, "input", "", "recording of -record or samples, one \"weight\" or \"seconds weight\" per line, - for stdin, default a generated step")
+	flag.Float64Var(&rate, "rate", 80, "sample rate in Hz of inputs without timestamps")
+	flag.IntVar(&quiet, "quiet", 200, "samples at the start and the end without a change of the weight")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [chain ...], e.g. median:5 mad:9:3.5,ema:0.2\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if quiet < 1 {
+		log.Fatalf("-quiet must be positive, got %d", quiet)
+	}
+
+	var samples []sample
+	var err error
+	switch input {
+	case "":
+		samples = generate()
+	case "-":
+		samples, err = load(os.Stdin)
+	default:
+		var rec *scale.RecordingReader
+		if rec, err = scale.OpenRecording(input); err == nil {
+			samples, err = loadRecording(rec)
+			rec.Close()
+			break
+		}
+		if !errors.Is(err, scale.ErrBadRecording) {
+			break
+		}
+
+		var f *os.File
+		if f, err = os.Open(input); err == nil {
+			samples, err = load(f)
+			f.Close()
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(samples) < 2*quiet {
+		log.Fatalf("%d samples, need at least twice -quiet (%d)", len(samples), quiet)
+	}
+
+	chains := []filter.Chain{nil}
+	for _, spec := range flag.Args() {
+		chain, err := filter.Parse(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		chains = append(chains, chain)
+	}
+
+	results := make([]result, len(chains))
+	for i, chain := range chains {
+		results[i] = evaluate(samples, chain)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHAIN\tNOISE\tREDUCTION\tLATENCY\t\tOVERSHOOT\tDROPPED")
+	for _, res := range results {
+		reduction := "-"
+		if res.noise > 0 {
+			reduction = fmt.Sprintf("%.1fx", results[0].noise/res.noise)
+		}
+		latency, seconds := "never", ""
+		if res.latency >= 0 {
+			latency = fmt.Sprintf("%d samples", res.latency)
+			seconds = fmt.Sprintf("%.0f ms", res.seconds*1000)
+		}
+		fmt.Fprintf(w, "%s\t%.3f\t%s\t%s\t%s\t%.1f%%\t%d\n",
+			res.chain, res.noise, reduction, latency, seconds, res.overshoot, res.dropped)
+	}
+	w.Flush()
+}
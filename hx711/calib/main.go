@@ -1,33 +1,113 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"flag"
 	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/SimonWaldherr/hx711go"
+	"github.com/SimonWaldherr/rpi-examples/calibration"
+	"github.com/SimonWaldherr/rpi-examples/scale"
 )
 
+var weightList string
+var fitKind string
+var curvePath string
+var readings int
+var stableCount int
+var tolerance int
+var settleTimeout time.Duration
+
 func main() {
-	err := hx711.HostInit()
+	adc := scale.NewOptions(flag.CommandLine)
+	flag.StringVar(&weightList, "weights", "33,66", "comma separated reference weights")
+	flag.StringVar(&fitKind, "fit", calibration.Linear, "fitted curve: linear, piecewise or polyN")
+	flag.StringVar(&curvePath, "curve", "", "file to store the fitted curve in")
+	flag.IntVar(&readings, "readings", 5, "number of conversions combined into one reading")
+	flag.IntVar(&stableCount, "stable", 3, "number of consecutive readings that must agree")
+	flag.IntVar(&tolerance, "tolerance", 100, "largest spread in counts of a stable reading")
+	flag.DurationVar(&settleTimeout, "timeout", time.Minute, "time to wait for a stable reading")
+	flag.Parse()
+
+	kind, degree, err := calibration.ParseKind(fitKind)
 	if err != nil {
-		fmt.Println("HostInit error:", err)
-		return
+		log.Fatal(err)
+	}
+
+	var weights []float64
+	for _, field := range strings.Split(weightList, ",") {
+		w, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || w <= 0 {
+			log.Fatalf("invalid reference weight %q", field)
+		}
+		weights = append(weights, w)
 	}
 
-	hx711, err := hx711.NewHx711("6", "5")
+	s, err := adc.Open()
 	if err != nil {
-		fmt.Println("NewHx711 error:", err)
+		fmt.Println("Open error:", err)
 		return
 	}
 
-	// SetGain default is 128
-	// Gain of 128 or 64 is input channel A, gain of 32 is input channel B
-	// hx711.SetGain(128)
+	defer s.Close()
 
-	var weight1 float64
-	var weight2 float64
+	stdin := bufio.NewReader(os.Stdin)
+	measure := func(prompt string) int {
+		fmt.Print(prompt)
+		if _, err := stdin.ReadString('\n'); err != nil {
+			log.Fatal(err)
+		}
 
-	weight1 = 33
-	weight2 = 66
+		ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+		defer cancel()
+
+		raw, err := scale.WaitStable(ctx, s, readings, stableCount, tolerance, func(raw, spread int) {
+			fmt.Printf("\rwaiting for a stable reading: %d (spread %d)   ", raw, spread)
+		})
+		fmt.Println()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("stable reading: %d\n", raw)
+		return raw
+	}
+
+	zero := measure("remove all weight from the scale and press enter ")
+
+	points := []calibration.Point{{Raw: 0, Weight: 0}}
+	for _, w := range weights {
+		raw := measure(fmt.Sprintf("place %v on the scale and press enter ", w))
+		points = append(points, calibration.Point{Raw: float64(raw - zero), Weight: w})
+	}
 
-	hx711.GetAdjustValues(weight1, weight2)
+	curve, err := calibration.Fit(kind, degree, points)
+	if err != nil {
+		log.Fatal(err)
+	}
+	curve.WriteReport(os.Stdout, points)
+
+	cal := scale.Calibration{Zero: zero, Curve: &curve}
+	fmt.Printf("AdjustZero: %d\n", zero)
+	if slope := curve.Slope(0); slope != 0 {
+		cal.Factor = 1 / slope
+		fmt.Printf("AdjustScale: %v\n", cal.Factor)
+	}
+
+	path, err := adc.SaveCalibration(cal)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("calibration stored in %s, hx711 and hx711/live load it from there\n", path)
+
+	if curvePath != "" {
+		if err = curve.Save(curvePath); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s curve stored in %s, use it with -zero %d -curve %s\n", curve.Kind, curvePath, zero, curvePath)
+	}
 }
@@ -0,0 +1,212 @@
+// dose fills containers to a target weight with a coarse and a fine feed
+// switched by relays on a PCF8574 or a duty cycle on a PCA9685 channel.
+//
+//	dose [-target 100] [-runs 5] [-output pcf8574|pca9685] [-sim] [-record FILE|-replay FILE]
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/SimonWaldherr/rpi-examples/dosing"
+	"github.com/SimonWaldherr/rpi-examples/i2cconf"
+	"github.com/SimonWaldherr/rpi-examples/i2csim"
+	"github.com/SimonWaldherr/rpi-examples/scale"
+)
+
+var cfg = dosing.DefaultConfig(100)
+var runs int
+var output string
+var simulate bool
+var coarseBit, fineBit uint
+var activeHigh bool
+var pwmChannel int
+var coarseDuty, fineDuty float64
+var relay, pwm *i2cconf.Setting
+
+// openFeed opens the output selected with -output on the real bus.
+func openFeed() (dosing.Feed, func() error, error) {
+	switch output {
+	case "pcf8574":
+		dev, err := relay.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		return &dosing.PCF8574Feed{Dev: dev, CoarseBit: coarseBit, FineBit: fineBit, ActiveHigh: activeHigh}, dev.Close, nil
+	case "pca9685":
+		dev, err := pwm.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		feed, err := dosing.NewPCA9685Feed(dev, pwmChannel, coarseDuty, fineDuty)
+		if err != nil {
+			dev.Close()
+			return nil, nil, err
+		}
+		return feed, dev.Close, nil
+	}
+	return nil, nil, fmt.Errorf("unknown output %q, use pcf8574 or pca9685", output)
+}
+
+// simFeed returns the output selected with -output on a simulated bus
+// whose chips switch the valve of sim.
+func simFeed(sim *dosing.Sim) (dosing.Feed, error) {
+	bus := i2csim.NewBus()
+
+	switch output {
+	case "pcf8574":
+		expander := i2csim.NewPCF8574()
+		expander.OnWrite = func(port byte) {
+			on := func(bit uint) bool { return (port>>bit&1 == 1) == activeHigh }
+			switch {
+			case on(coarseBit):
+				sim.Set(dosing.Coarse)
+			case on(fineBit):
+				sim.Set(dosing.Fine)
+			default:
+				sim.Set(dosing.Off)
+			}
+		}
+		bus.Attach(int(relay.Address), expander)
+		conn, err := bus.Open(int(relay.Address))
+		if err != nil {
+			return nil, err
+		}
+		return &dosing.PCF8574Feed{Dev: conn, CoarseBit: coarseBit, FineBit: fineBit, ActiveHigh: activeHigh}, nil
+	case "pca9685":
+		controller := i2csim.NewPCA9685()
+		bus.Attach(int(pwm.Address), controller)
+		conn, err := bus.Open(int(pwm.Address))
+		if err != nil {
+			return nil, err
+		}
+		valve := &dosing.SimValve{Conn: conn, PWM: controller, Sim: sim, Channel: pwmChannel, FineDuty: fineDuty}
+		return dosing.NewPCA9685Feed(valve, pwmChannel, coarseDuty, fineDuty)
+	}
+	return nil, fmt.Errorf("unknown output %q, use pcf8574 or pca9685", output)
+}
+
+// replayFeed is the output while a recording is played back, the valves
+// cannot change the recorded weights.
+type replayFeed struct{}
+
+func (replayFeed) Set(rate dosing.Rate) error {
+	return nil
+}
+
+// run doses -runs containers, prepare is called before every run, nil
+// asks for an empty container.
+func run(c *dosing.Controller, prepare func()) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c.OnState = func(state dosing.State, weight float64) {
+		fmt.Printf("%-9v %8.2f\n", state, weight)
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	for i := 1; i <= runs; i++ {
+		if prepare != nil {
+			prepare()
+		} else {
+			fmt.Print("place an empty container on the scale and press enter ")
+			if _, err := stdin.ReadString('\n'); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		result, err := c.Run(ctx)
+		fmt.Printf("run %d: %.2f of %.2f (%+.2f) in %v, %d top-ups, pre-act %.2f -> %.2f\n",
+			i, result.Actual, result.Target, result.Deviation(), result.Duration.Round(1e6),
+			result.TopUps, result.PreAct, result.Learned)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fmt.Printf("use -preact %.2f to start with the learned pre-act\n", c.PreAct())
+}
+
+func main() {
+	adc := scale.NewOptions(flag.CommandLine)
+	relay = adc.I2C().Add("relay", "relay-addr", i2cconf.PCF8574, 0x20)
+	pwm = adc.I2C().Add("valve", "pwm-addr", i2cconf.PCA9685, 0x40)
+
+	flag.Float64Var(&cfg.Target, "target", cfg.Target, "target weight")
+	switchover := flag.Float64("switchover", 0, "distance to the target where the coarse feed stops, default 10% of the target")
+	tolerance := flag.Float64("tolerance", 0, "accepted deviation from the target, default 1% of the target")
+	flag.Float64Var(&cfg.PreAct, "preact", cfg.PreAct, "initial in-flight compensation")
+	flag.Float64Var(&cfg.Learn, "learn", cfg.Learn, "share of the deviation added to the pre-act after a run")
+	flag.DurationVar(&cfg.Settle, "settle", cfg.Settle, "time the scale settles after the feed stopped")
+	flag.IntVar(&cfg.TopUps, "topups", cfg.TopUps, "fine feeds after a short run")
+	flag.DurationVar(&cfg.Timeout, "timeout", cfg.Timeout, "time limit of one run")
+	flag.IntVar(&runs, "runs", 1, "number of containers to fill")
+	flag.StringVar(&output, "output", "pcf8574", "output switching the feed: pcf8574 or pca9685")
+	flag.UintVar(&coarseBit, "coarse-bit", 0, "PCF8574 pin of the coarse feed relay")
+	flag.UintVar(&fineBit, "fine-bit", 1, "PCF8574 pin of the fine feed relay")
+	flag.BoolVar(&activeHigh, "active-high", false, "the relays switch on a high pin")
+	flag.IntVar(&pwmChannel, "pwm-channel", 0, "PCA9685 channel of the feed")
+	flag.Float64Var(&coarseDuty, "coarse-duty", 1, "PCA9685 duty cycle of the coarse feed")
+	flag.Float64Var(&fineDuty, "fine-duty", 0.25, "PCA9685 duty cycle of the fine feed")
+	flag.BoolVar(&simulate, "sim", false, "dose with a simulated scale and valve")
+	flag.Parse()
+
+	cfg.Switchover = cfg.Target * 0.1
+	if *switchover > 0 {
+		cfg.Switchover = *switchover
+	}
+	cfg.Tolerance = cfg.Target * 0.01
+	if *tolerance > 0 {
+		cfg.Tolerance = *tolerance
+	}
+
+	if err := adc.I2C().Resolve(); err != nil {
+		log.Fatal(err)
+	}
+
+	if simulate && !adc.Replaying() {
+		sim := dosing.NewSim()
+		feed, err := simFeed(sim)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s, _, err := adc.Record().Open(func() (scale.Scale, error) { return sim, nil }, "")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer s.Close()
+		run(dosing.New(s, feed, cfg), sim.Empty)
+		return
+	}
+
+	var feed dosing.Feed = replayFeed{}
+	if !adc.Replaying() {
+		f, closeFeed, err := openFeed()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer closeFeed()
+		feed = f
+	}
+
+	s, err := adc.Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+
+	if err = adc.Adjust(s, s.GetCalibration()); err != nil {
+		log.Fatal(err)
+	}
+
+	var prepare func()
+	if adc.Replaying() {
+		prepare = func() {}
+	}
+	run(dosing.New(s, feed, cfg), prepare)
+}
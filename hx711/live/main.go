@@ -1,13 +1,15 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"runtime"
 	"time"
 
-	"github.com/SimonWaldherr/hx711go"
+	"github.com/SimonWaldherr/rpi-examples/calibration"
+	"github.com/SimonWaldherr/rpi-examples/scale"
 	"simonwaldherr.de/go/golibs/gcurses"
 	"simonwaldherr.de/go/golibs/xmath"
 )
@@ -15,105 +17,123 @@ import (
 var TargetWeight int
 var AdjustZero int
 var AdjustScale float64
+var CurvePath string
+var Curve *calibration.Curve
 
-func scaleDelay(scaleDelta int, timeout time.Duration) {
+func scaleDelay(s scale.Scale, scaleDelta int, timeout time.Duration) {
 	runtime.GC()
-	hx711, err := hx711.NewHx711("6", "5")
 
-	if err != nil {
-		fmt.Println("NewHx711 error:", err)
-		return
-	}
-
-	defer hx711.Shutdown()
-
-	for {
-		err = hx711.Reset()
-		if err == nil {
-			break
+	if h, ok := scale.Unwrap(s).(*scale.HX711); ok {
+		for {
+			err := h.Dev.Reset()
+			if err == nil {
+				break
+			}
+			log.Print("hx711 BackgroundReadMovingAvgs Reset error:", err)
+			time.Sleep(time.Second)
 		}
-		log.Print("hx711 BackgroundReadMovingAvgs Reset error:", err)
-		time.Sleep(time.Second)
 	}
 
-	hx711.AdjustZero = AdjustZero
-	hx711.AdjustScale = AdjustScale
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	c1 := make(chan bool, 1)
-	go func() {
-		var tara = []float64{}
-		var i int
-		var data, predata float64
+	var data, predata float64
 
+	// without a -tare the first stable weight is the tare
+	t, _ := s.(*scale.Tared)
+	tared := t == nil
+	if t != nil {
+		if tare, name := t.GetTare(); tare != 0 || name != "" {
+			fmt.Printf("tare %v %s\n", tare, name)
+			tared = true
+		}
+	}
+	if !tared {
 		fmt.Println("Tara")
+	}
 
-		for i = 0; i < 5; i++ {
-			time.Sleep(600 * time.Microsecond)
-
-			data, err := hx711.ReadDataMedian(3)
-			if err != nil {
-				fmt.Println("ReadDataRaw error:", err)
-				continue
-			}
+	writer := gcurses.New()
+	writer.Start()
 
-			tara = append(tara, data)
+	channel := -1
+	for r := range s.Stream(ctx) {
+		// a board with two load cells alternates, follow the first one
+		if channel < 0 {
+			channel = r.Channel
+		}
+		if r.Channel != channel {
+			continue
 		}
-		taraAvg := float64(xmath.Round(xmath.Arithmetic(tara)))
-
-		fmt.Printf("New tara set to: %v\n", taraAvg)
-
-		writer := gcurses.New()
-		writer.Start()
-
-		for {
-			time.Sleep(10 * time.Millisecond)
-			data2, err := hx711.ReadDataRaw()
 
-			if err != nil {
-				if fmt.Sprintln("ReadDataRaw error:", err) != "ReadDataRaw error: waitForDataReady error: timeout\n" {
-					fmt.Println("ReadDataRaw error:", err)
-				}
+		if !tared {
+			if t.PushTare() != nil {
 				continue
 			}
+			tared = true
+			continue
+		}
 
+		// failed reads are counted by the scale and shown as a rate
+		if r.Err == nil {
 			predata = data
-			data = (float64(data2-hx711.AdjustZero) / hx711.AdjustScale) - taraAvg
-
-			fmt.Fprintf(writer, "scale value: %d\n", xmath.Round((data+predata)/2))
-			if int(data) > scaleDelta && int(predata) > scaleDelta {
-				writer.Stop()
-				fmt.Printf("set weight reached. weight is: %d\n", xmath.Round(data))
-				c1 <- true
-				return
-			}
+			data = r.Weight
 		}
-	}()
 
-	select {
-	case _ = <-c1:
-		return
-	case <-time.After(timeout):
-		fmt.Println("timeout")
-		return
+		state := "moving"
+		if r.Stable {
+			state = "stable"
+		}
+		fmt.Fprintf(writer, "scale value: %d (%s)\ngross: %.1f tare: %.1f\nread errors: %v\n",
+			xmath.Round((data+predata)/2), state, r.Gross, r.Tare, s.GetErrorCounts())
+		if r.Err != nil {
+			continue
+		}
+		if int(data) > scaleDelta && int(predata) > scaleDelta {
+			writer.Stop()
+			fmt.Printf("set weight reached. weight is: %d\n", xmath.Round(data))
+			return
+		}
 	}
+
+	writer.Stop()
+	fmt.Println("timeout")
 }
 
 func main() {
 	runtime.GOMAXPROCS(3)
+	adc := scale.NewOptions(flag.CommandLine)
 	flag.IntVar(&TargetWeight, "target", 100, "weight to be measured")
 	flag.IntVar(&AdjustZero, "zero", -94932, "adjust zero value")
 	flag.Float64Var(&AdjustScale, "scale", 62.8, "adjust scale value")
+	flag.StringVar(&CurvePath, "curve", "", "calibration curve from hx711/calib, replaces -scale")
 	flag.Parse()
 
-	err := hx711.HostInit()
+	if CurvePath != "" {
+		var err error
+		Curve, err = calibration.Load(CurvePath)
+		if err != nil {
+			fmt.Println("calibration curve error:", err)
+			return
+		}
+	}
+
+	s, err := adc.Open()
+	if err != nil {
+		fmt.Println("Open error:", err)
+		return
+	}
+
+	defer s.Close()
+
+	err = adc.Adjust(s, scale.Calibration{Zero: AdjustZero, Factor: AdjustScale, Curve: Curve})
 	if err != nil {
-		fmt.Println("HostInit error:", err)
+		fmt.Println("calibration error:", err)
 		return
 	}
 
 	fmt.Printf("measurement target set to %d\n", TargetWeight)
 
-	scaleDelay(TargetWeight, 5*time.Minute)
+	scaleDelay(s, TargetWeight, 5*time.Minute)
 
 	fmt.Println("measurement completed")
 }
@@ -4,35 +4,61 @@ import (
 	"flag"
 	"fmt"
 
-	"github.com/SimonWaldherr/hx711go"
+	"github.com/SimonWaldherr/rpi-examples/calibration"
+	"github.com/SimonWaldherr/rpi-examples/scale"
 )
 
 var TargetWeight int
 var AdjustZero int
 var AdjustScale float64
+var CurvePath string
 
 func main() {
+	adc := scale.NewOptions(flag.CommandLine)
 	flag.IntVar(&TargetWeight, "target", 100, "weight to be measured")
 	flag.IntVar(&AdjustZero, "zero", -94932, "adjust zero value")
 	flag.Float64Var(&AdjustScale, "scale", 62.8, "adjust scale value")
+	flag.StringVar(&CurvePath, "curve", "", "calibration curve from hx711/calib, replaces -scale")
 	flag.Parse()
 
-	err := hx711.HostInit()
+	var curve *calibration.Curve
+	if CurvePath != "" {
+		var err error
+		curve, err = calibration.Load(CurvePath)
+		if err != nil {
+			fmt.Println("calibration curve error:", err)
+			return
+		}
+	}
+
+	s, err := adc.Open()
 	if err != nil {
-		fmt.Println("HostInit error:", err)
+		fmt.Println("Open error:", err)
 		return
 	}
 
-	hx711, err := hx711.NewHx711("6", "5")
+	defer s.Close()
 
-	defer hx711.Shutdown()
+	err = adc.Adjust(s, scale.Calibration{Zero: AdjustZero, Factor: AdjustScale, Curve: curve})
+	if err != nil {
+		fmt.Println("calibration error:", err)
+		return
+	}
 
-	hx711.AdjustZero = AdjustZero
-	hx711.AdjustScale = AdjustScale
+	if hx, ok := scale.Unwrap(s).(*scale.HX711); ok && hx.Dual() {
+		a, b, err := hx.ReadChannels(3)
+		if err != nil {
+			fmt.Println("ReadChannels error:", err)
+			return
+		}
+		fmt.Printf("measurement A: %v\n", hx.GetCalibration().Weight(a))
+		fmt.Printf("measurement B: %v\n", hx.GetSecondChannel().Weight(b))
+		return
+	}
 
-	data, err := hx711.ReadDataMedian(3)
+	data, err := s.ReadWeight(3)
 	if err != nil {
-		fmt.Println("ReadDataRaw error:", err)
+		fmt.Println("ReadWeight error:", err)
 		return
 	}
 	fmt.Printf("measurement: %v\n", data)
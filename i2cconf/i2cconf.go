@@ -0,0 +1,262 @@
+// Package i2cconf selects the I2C bus and the device addresses of the
+// example programs. For every device the bus and address are taken from, in
+// increasing priority:
+//
+//   - the defaults of the program
+//   - a shared JSON file given with -i2c-config or I2C_CONFIG
+//   - the environment: I2C_BUS and <NAME>_ADDR, e.g. NAU7802_ADDR
+//   - the command line: -bus and the address flag of the device
+//
+// The file holds a default bus and one entry per device name:
+//
+//	{
+//	  "bus": "/dev/i2c-3",
+//	  "devices": {
+//	    "pcf8574": {"address": "0x38"},
+//	    "nau7802": {"bus": "/dev/i2c-1"}
+//	  }
+//	}
+package i2cconf
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/io/i2c"
+)
+
+const DefaultBus = "/dev/i2c-1"
+
+// Chip describes the addresses a chip can be strapped to.
+type Chip struct {
+	Name   string
+	Ranges [][2]int // inclusive
+}
+
+var (
+	NAU7802 = Chip{Name: "NAU7802", Ranges: [][2]int{{0x2A, 0x2A}}}
+	// PCF8574 covers the PCF8574 (0x20-0x27) and the PCF8574A (0x38-0x3F)
+	PCF8574 = Chip{Name: "PCF8574", Ranges: [][2]int{{0x20, 0x27}, {0x38, 0x3F}}}
+	// PCA9685 leaves out the All Call address 0x70 it answers to after
+	// power-on and the reserved addresses from 0x78
+	PCA9685 = Chip{Name: "PCA9685", Ranges: [][2]int{{0x40, 0x6F}, {0x71, 0x77}}}
+)
+
+var ErrInvalidAddress = errors.New("i2cconf: invalid address")
+
+// Validate checks that the chip can be strapped to addr.
+func (c Chip) Validate(addr int) error {
+	for _, r := range c.Ranges {
+		if addr >= r[0] && addr <= r[1] {
+			return nil
+		}
+	}
+
+	ranges := make([]string, len(c.Ranges))
+	for i, r := range c.Ranges {
+		if r[0] == r[1] {
+			ranges[i] = fmt.Sprintf("0x%02X", r[0])
+		} else {
+			ranges[i] = fmt.Sprintf("0x%02X-0x%02X", r[0], r[1])
+		}
+	}
+	return fmt.Errorf("%w 0x%02X for the %s, use %s", ErrInvalidAddress, addr, c.Name, strings.Join(ranges, " or "))
+}
+
+// Address is a 7-bit I2C address. It is parsed from decimal, 0x hex or
+// 0o octal numbers, in JSON also from strings.
+type Address int
+
+func (a Address) String() string {
+	return fmt.Sprintf("0x%02X", int(a))
+}
+
+func (a *Address) Set(s string) error {
+	v, err := strconv.ParseInt(strings.TrimSpace(s), 0, 0)
+	if err != nil || v < 0 || v > 0x7F {
+		return fmt.Errorf("%w %q", ErrInvalidAddress, s)
+	}
+	*a = Address(v)
+	return nil
+}
+
+func (a Address) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+func (a *Address) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		return a.Set(s)
+	}
+	return a.Set(string(data))
+}
+
+// Device is the bus and address of one chip.
+type Device struct {
+	Bus     string  `json:"bus,omitempty"`
+	Address Address `json:"address,omitempty"`
+}
+
+// Open opens the device on its bus.
+func (d Device) Open() (*i2c.Device, error) {
+	return i2c.Open(&i2c.Devfs{Dev: d.Bus}, int(d.Address))
+}
+
+func (d Device) String() string {
+	return fmt.Sprintf("%s@%s", d.Bus, d.Address)
+}
+
+// File is the shared configuration file.
+type File struct {
+	Bus     string            `json:"bus,omitempty"`
+	Devices map[string]Device `json:"devices,omitempty"`
+}
+
+// Load reads a configuration file.
+func Load(path string) (File, error) {
+	var f File
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+
+	if err = json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("i2cconf: %s: %v", path, err)
+	}
+	return f, nil
+}
+
+// Setting is one device of a program, its Device is known after Resolve.
+type Setting struct {
+	Name string
+	Chip Chip
+	Device
+
+	addr Address
+	flag string
+}
+
+// Options are the I2C flags of a program.
+type Options struct {
+	fs       *flag.FlagSet
+	bus      string
+	config   string
+	settings []*Setting
+	resolved string
+}
+
+// NewOptions registers -bus and -i2c-config on fs.
+func NewOptions(fs *flag.FlagSet) *Options {
+	o := &Options{fs: fs}
+	fs.StringVar(&o.bus, "bus", "", "I2C bus device, default $I2C_BUS or "+DefaultBus)
+	fs.StringVar(&o.config, "i2c-config", "", "JSON file with the I2C bus and addresses, default $I2C_CONFIG")
+	return o
+}
+
+// Add registers a device with its default address. The address can be
+// changed with the flag named flagName and the <NAME>_ADDR environment
+// variable, name is also the key in the configuration file.
+func (o *Options) Add(name, flagName string, chip Chip, addr int) *Setting {
+	s := &Setting{
+		Name:   name,
+		Chip:   chip,
+		Device: Device{Address: Address(addr)},
+		flag:   flagName,
+	}
+	o.fs.Var(&s.addr, flagName, fmt.Sprintf("I2C address of the %s, default $%s or %s", chip.Name, envName(name), Address(addr)))
+	o.settings = append(o.settings, s)
+	return s
+}
+
+// envName returns the environment variable of the address of a device.
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name) + "_ADDR"
+}
+
+// Bus returns the bus used by devices without an entry in the
+// configuration file, it is known after Resolve.
+func (o *Options) Bus() string {
+	return o.resolved
+}
+
+// Resolve determines the bus and address of every device after the flags
+// were parsed and validates the addresses.
+func (o *Options) Resolve() error {
+	set := make(map[string]bool)
+	o.fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var file File
+	path := o.config
+	if path == "" {
+		path = os.Getenv("I2C_CONFIG")
+	}
+	if path != "" {
+		var err error
+		if file, err = Load(path); err != nil {
+			return err
+		}
+	}
+
+	o.resolved = DefaultBus
+	if file.Bus != "" {
+		o.resolved = file.Bus
+	}
+	if bus := os.Getenv("I2C_BUS"); bus != "" {
+		o.resolved = bus
+	}
+	if set["bus"] {
+		o.resolved = o.bus
+	}
+
+	for _, s := range o.settings {
+		s.Bus = DefaultBus
+		if file.Bus != "" {
+			s.Bus = file.Bus
+		}
+		if d, ok := file.Devices[s.Name]; ok {
+			if d.Bus != "" {
+				s.Bus = d.Bus
+			}
+			if d.Address != 0 {
+				s.Address = d.Address
+			}
+		}
+
+		if bus := os.Getenv("I2C_BUS"); bus != "" {
+			s.Bus = bus
+		}
+		if env := os.Getenv(envName(s.Name)); env != "" {
+			if err := s.Address.Set(env); err != nil {
+				return fmt.Errorf("%s: %w", envName(s.Name), err)
+			}
+		}
+
+		if set["bus"] {
+			s.Bus = o.bus
+		}
+		if set[s.flag] {
+			s.Address = s.addr
+		}
+
+		if err := s.Chip.Validate(int(s.Address)); err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+	}
+
+	return nil
+}
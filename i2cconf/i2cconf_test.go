@@ -0,0 +1,161 @@
+package i2cconf
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	const file = `{"bus": "/dev/i2c-3", "devices": {"pcf8574": {"address": "0x38"}, "nau7802": {"bus": "/dev/i2c-2"}}}`
+
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		args    []string
+		bus     string
+		address Address
+		err     error
+	}{
+		{"defaults", "", nil, nil, DefaultBus, 0x20, nil},
+		{"file", file, nil, nil, "/dev/i2c-3", 0x38, nil},
+		{"environment over file", file, map[string]string{"I2C_BUS": "/dev/i2c-4", "PCF8574_ADDR": "0x21"}, nil, "/dev/i2c-4", 0x21, nil},
+		{"flags over environment", file, map[string]string{"I2C_BUS": "/dev/i2c-4", "PCF8574_ADDR": "0x21"}, []string{"-bus", "/dev/i2c-5", "-addr", "0x22"}, "/dev/i2c-5", 0x22, nil},
+		{"flag over file", file, nil, []string{"-addr", "0x3A"}, "/dev/i2c-3", 0x3A, nil},
+		{"invalid environment", "", map[string]string{"PCF8574_ADDR": "relay"}, nil, "", 0, ErrInvalidAddress},
+		{"address of another chip", "", nil, []string{"-addr", "0x40"}, "", 0, ErrInvalidAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"I2C_CONFIG", "I2C_BUS", "PCF8574_ADDR", "NAU7802_ADDR"} {
+				t.Setenv(name, tt.env[name])
+			}
+			if tt.file != "" {
+				path := filepath.Join(t.TempDir(), "i2c.json")
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv("I2C_CONFIG", path)
+			}
+
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			o := NewOptions(fs)
+			relay := o.Add("pcf8574", "addr", PCF8574, 0x20)
+			adc := o.Add("nau7802", "nau7802-addr", NAU7802, 0x2A)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := o.Resolve()
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if relay.Bus != tt.bus || relay.Address != tt.address {
+				t.Errorf("got %v, want %s@%s", relay.Device, tt.bus, tt.address)
+			}
+			if o.Bus() != tt.bus {
+				t.Errorf("default bus %s, want %s", o.Bus(), tt.bus)
+			}
+
+			// the file puts the NAU7802 on a bus of its own, the
+			// environment and the flags override it
+			want := tt.bus
+			if tt.file != "" && tt.bus == "/dev/i2c-3" {
+				want = "/dev/i2c-2"
+			}
+			if adc.Bus != want || adc.Address != 0x2A {
+				t.Errorf("NAU7802 at %v, want %s@0x2A", adc.Device, want)
+			}
+		})
+	}
+}
+
+func TestChipValidate(t *testing.T) {
+	tests := []struct {
+		chip  Chip
+		addr  int
+		valid bool
+	}{
+		{NAU7802, 0x2A, true},
+		{NAU7802, 0x2B, false},
+		{PCF8574, 0x1F, false},
+		{PCF8574, 0x20, true},
+		{PCF8574, 0x27, true},
+		{PCF8574, 0x28, false},
+		{PCF8574, 0x37, false},
+		{PCF8574, 0x38, true},
+		{PCF8574, 0x3F, true},
+		{PCF8574, 0x40, false},
+		{PCA9685, 0x3F, false},
+		{PCA9685, 0x40, true},
+		{PCA9685, 0x6F, true},
+		{PCA9685, 0x70, false},
+		{PCA9685, 0x71, true},
+		{PCA9685, 0x77, true},
+		{PCA9685, 0x78, false},
+		{PCA9685, 0x7F, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.chip.Name+" "+Address(tt.addr).String(), func(t *testing.T) {
+			err := tt.chip.Validate(tt.addr)
+			if tt.valid && err != nil {
+				t.Errorf("got %v, want valid", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidAddress) {
+				t.Errorf("got %v, want %v", err, ErrInvalidAddress)
+			}
+		})
+	}
+}
+
+func TestAddressJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want Address
+		err  bool
+	}{
+		{`"0x38"`, 0x38, false},
+		{`" 0x2a "`, 0x2A, false},
+		{`"56"`, 56, false},
+		{`"0o70"`, 0o70, false},
+		{`56`, 56, false},
+		{`0`, 0, false},
+		{`"0x80"`, 0, true},
+		{`-1`, 0, true},
+		{`"relay"`, 0, true},
+		{`true`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			var a Address
+			err := json.Unmarshal([]byte(tt.json), &a)
+			if tt.err {
+				if err == nil {
+					t.Errorf("got %s, want an error", a)
+				}
+				return
+			}
+			if err != nil || a != tt.want {
+				t.Errorf("got %s, %v, want %s", a, err, tt.want)
+			}
+		})
+	}
+
+	data, err := json.Marshal(Device{Bus: DefaultBus, Address: 0x38})
+	if err != nil || string(data) != `{"bus":"/dev/i2c-1","address":"0x38"}` {
+		t.Errorf("got %s, %v", data, err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/SimonWaldherr/rpi-examples/i2cconf"
+	"github.com/SimonWaldherr/rpi-examples/i2csim"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+)
+
+// Conn is a connection to one address, *i2c.Device and *i2csim.Conn
+// implement it.
+type Conn interface {
+	Read(buf []byte) error
+	ReadReg(reg byte, buf []byte) error
+	Close() error
+}
+
+const pca9685AllCall = 0x70
+
+// Result is a device found by the scan.
+type Result struct {
+	Address i2cconf.Address `json:"address"`
+	Chip    string          `json:"chip"`
+	Details string          `json:"details,omitempty"`
+}
+
+// identify probes addr. It only reads: the pins of a PCF8574 follow every
+// byte written to it, so even a register pointer written while guessing
+// could switch a relay. A chip that answers but is not recognized is
+// reported as unknown, found is false if nothing answered.
+func identify(c Conn, addr int) (r Result, found bool) {
+	r = Result{Address: i2cconf.Address(addr), Chip: "unknown"}
+
+	var buf [1]byte
+	if c.Read(buf[:]) != nil {
+		return r, false
+	}
+
+	switch {
+	case i2cconf.NAU7802.Validate(addr) == nil:
+		if chip, details, ok := nau7802(c); ok {
+			r.Chip, r.Details = chip, details
+		}
+	case i2cconf.PCF8574.Validate(addr) == nil:
+		// nothing to ask, the answer is the port itself
+		r.Chip = "PCF8574"
+		if addr >= 0x38 {
+			r.Chip = "PCF8574A"
+		}
+		r.Details = fmt.Sprintf("port 0b%08b", buf[0])
+	case i2cconf.PCA9685.Validate(addr) == nil, addr == pca9685AllCall:
+		if chip, details, ok := pca9685(c); ok {
+			r.Chip, r.Details = chip, details
+			if addr == pca9685AllCall {
+				r.Details = "All Call address, " + details
+			}
+		}
+	}
+
+	return r, true
+}
+
+// nau7802 recognizes the NAU7802 by the revision id in the low nibble of
+// DEVICE_REV.
+func nau7802(c Conn) (chip, details string, ok bool) {
+	var rev, pu [1]byte
+	if c.ReadReg(device.NAU7802_DEVICE_REV, rev[:]) != nil || rev[0]&0x0F != 0x0F {
+		return "", "", false
+	}
+	if c.ReadReg(device.NAU7802_PU_CTRL, pu[:]) != nil {
+		return "", "", false
+	}
+
+	state := "powered down"
+	if pu[0]&(1<<device.NAU7802_PU_CTRL_PUD|1<<device.NAU7802_PU_CTRL_PUA) != 0 {
+		state = "powered up"
+	}
+	return "NAU7802", fmt.Sprintf("revision 0x%X, %s", rev[0]&0x0F, state), true
+}
+
+// pca9685 recognizes the PCA9685 by the reserved bits of MODE2 and
+// ALLCALLADR that always read 0 and a pre-scaler not below its minimum
+// of 3.
+func pca9685(c Conn) (chip, details string, ok bool) {
+	var mode [2]byte
+	var allCall, prescale [1]byte
+	if c.ReadReg(i2csim.PCA9685_MODE1, mode[:1]) != nil ||
+		c.ReadReg(i2csim.PCA9685_MODE2, mode[1:]) != nil ||
+		c.ReadReg(i2csim.PCA9685_ALLCALLADR, allCall[:]) != nil ||
+		c.ReadReg(i2csim.PCA9685_PRE_SCALE, prescale[:]) != nil {
+		return "", "", false
+	}
+	if mode[1]&0xE0 != 0 || allCall[0]&0x01 != 0 || prescale[0] < 3 {
+		return "", "", false
+	}
+
+	state := "running"
+	if mode[0]&i2csim.PCA9685_MODE1_SLEEP != 0 {
+		state = "sleeping"
+	}
+	freq := 25e6 / (4096 * (float64(prescale[0]) + 1))
+	return "PCA9685", fmt.Sprintf("%s, %.0f Hz (prescale %d)", state, freq, prescale[0]), true
+}
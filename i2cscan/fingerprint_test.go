@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/SimonWaldherr/rpi-examples/i2csim"
+)
+
+func TestScan(t *testing.T) {
+	b := simBus()
+	writes := 0
+	expander := i2csim.NewPCF8574()
+	expander.OnWrite = func(byte) { writes++ }
+	b.Attach(0x21, expander)
+
+	results, err := scan(func(addr int) (Conn, error) { return b.Open(addr) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]string)
+	for _, r := range results {
+		found[r.Address.String()] = r.Chip
+	}
+
+	tests := []struct {
+		addr string
+		chip string
+	}{
+		{"0x20", "PCF8574"},
+		{"0x21", "PCF8574"},
+		{"0x2A", "NAU7802"},
+		{"0x39", "PCF8574A"},
+		{"0x40", "PCA9685"},
+		{"0x50", "unknown"},
+		{"0x70", "PCA9685"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if chip := found[tt.addr]; chip != tt.chip {
+				t.Errorf("found %q, want %q", chip, tt.chip)
+			}
+			delete(found, tt.addr)
+		})
+	}
+	for addr, chip := range found {
+		t.Errorf("found %q at the empty address %s", chip, addr)
+	}
+
+	if writes != 0 {
+		t.Errorf("the PCF8574 probe wrote %d times", writes)
+	}
+}
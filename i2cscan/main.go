@@ -0,0 +1,112 @@
+// i2cscan lists the chips on an I2C bus like i2cdetect and tells which of
+// them are a NAU7802, PCA9685 or PCF8574.
+//
+//	i2cscan [-bus /dev/i2c-1] [-json] [-sim]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/SimonWaldherr/rpi-examples/i2cconf"
+	"github.com/SimonWaldherr/rpi-examples/i2csim"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/sim"
+	"golang.org/x/exp/io/i2c"
+)
+
+// Addresses below and above are reserved.
+const (
+	firstAddress = 0x03
+	lastAddress  = 0x77
+)
+
+var (
+	jsonOutput = flag.Bool("json", false, "print the result as JSON")
+	simulate   = flag.Bool("sim", false, "scan a simulated bus with one chip of each kind")
+)
+
+// simBus returns a bus with a NAU7802, a PCA9685 in its power-on state that
+// also answers to the All Call address, two PCF8574 and an EEPROM.
+func simBus() *i2csim.Bus {
+	bus := i2csim.NewBus()
+	bus.Attach(0x2A, i2csim.Registers(sim.New()))
+
+	pwm := i2csim.NewPCA9685()
+	bus.Attach(0x40, pwm)
+	bus.Attach(pca9685AllCall, pwm)
+
+	bus.Attach(0x20, i2csim.NewPCF8574())
+	inputs := i2csim.NewPCF8574()
+	inputs.PullLow(0x05)
+	bus.Attach(0x39, inputs)
+
+	bus.Attach(0x50, &i2csim.Memory{})
+	return bus
+}
+
+func scan(open func(addr int) (Conn, error)) ([]Result, error) {
+	var results []Result
+	for addr := firstAddress; addr <= lastAddress; addr++ {
+		c, err := open(addr)
+		if err != nil {
+			return nil, err
+		}
+		r, found := identify(c, addr)
+		c.Close()
+		if found {
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+func main() {
+	bus := i2cconf.NewOptions(flag.CommandLine)
+	flag.Parse()
+
+	if err := bus.Resolve(); err != nil {
+		log.Fatal(err)
+	}
+
+	open := func(addr int) (Conn, error) {
+		return i2c.Open(&i2c.Devfs{Dev: bus.Bus()}, addr)
+	}
+	if *simulate {
+		b := simBus()
+		open = func(addr int) (Conn, error) {
+			return b.Open(addr)
+		}
+	}
+
+	results, err := scan(open)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *jsonOutput {
+		if results == nil {
+			results = []Result{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if len(results) == 0 {
+		fmt.Println("no devices found")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDR\tCHIP\tDETAILS")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Address, r.Chip, r.Details)
+	}
+	w.Flush()
+}
@@ -0,0 +1,170 @@
+// Package i2csim simulates an I2C bus with chips attached to it, so the
+// examples can be run without the hardware. A Conn to an address behaves
+// like *i2c.Device from golang.org/x/exp/io/i2c: transfers to addresses
+// without a chip fail as if they were not acknowledged.
+package i2csim
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrNoAck = errors.New("i2csim: no acknowledge")
+
+// Device is a chip on the simulated bus. Write and Read are plain
+// transfers, register access is a write of the register address followed
+// by a read or by the data.
+type Device interface {
+	Write(buf []byte) error
+	Read(buf []byte) error
+}
+
+// Bus is a simulated I2C bus.
+type Bus struct {
+	mu      sync.Mutex
+	devices map[int]Device
+}
+
+func NewBus() *Bus {
+	return &Bus{devices: make(map[int]Device)}
+}
+
+// Attach puts a device at addr.
+func (b *Bus) Attach(addr int, d Device) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.devices[addr] = d
+}
+
+// Open returns a connection to addr. Like on the real bus this succeeds
+// even if no chip answers there.
+func (b *Bus) Open(addr int) (*Conn, error) {
+	if addr < 0 || addr > 0x7F {
+		return nil, fmt.Errorf("i2csim: invalid address 0x%02X", addr)
+	}
+	return &Conn{bus: b, addr: addr}, nil
+}
+
+// Conn is a connection to one address of the bus.
+type Conn struct {
+	bus  *Bus
+	addr int
+}
+
+func (c *Conn) device() (Device, error) {
+	c.bus.mu.Lock()
+	defer c.bus.mu.Unlock()
+
+	d, ok := c.bus.devices[c.addr]
+	if !ok {
+		return nil, ErrNoAck
+	}
+	return d, nil
+}
+
+func (c *Conn) Read(buf []byte) error {
+	d, err := c.device()
+	if err != nil {
+		return err
+	}
+	return d.Read(buf)
+}
+
+func (c *Conn) Write(buf []byte) error {
+	d, err := c.device()
+	if err != nil {
+		return err
+	}
+	return d.Write(buf)
+}
+
+func (c *Conn) ReadReg(reg byte, buf []byte) error {
+	if err := c.Write([]byte{reg}); err != nil {
+		return err
+	}
+	return c.Read(buf)
+}
+
+func (c *Conn) WriteReg(reg byte, buf []byte) error {
+	return c.Write(append([]byte{reg}, buf...))
+}
+
+func (c *Conn) Close() error {
+	return nil
+}
+
+// RegisterDevice is a chip model with register access, like the NAU7802
+// simulator in nau7802/sim.
+type RegisterDevice interface {
+	ReadReg(reg byte, buf []byte) error
+	WriteReg(reg byte, buf []byte) error
+}
+
+// Registers attaches a register model to the bus. The first byte of a
+// write selects the register, reads continue at the selected one.
+func Registers(d RegisterDevice) Device {
+	return &registers{dev: d}
+}
+
+type registers struct {
+	mu  sync.Mutex
+	dev RegisterDevice
+	reg byte
+}
+
+func (r *registers) Write(buf []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(buf) == 0 {
+		return nil
+	}
+	r.reg = buf[0]
+	if len(buf) > 1 {
+		return r.dev.WriteReg(r.reg, buf[1:])
+	}
+	return nil
+}
+
+func (r *registers) Read(buf []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.dev.ReadReg(r.reg, buf)
+}
+
+// Memory is a chip with 256 plain registers and auto-increment, like a
+// small EEPROM. It stands in for chips the examples know nothing about.
+type Memory struct {
+	mu   sync.Mutex
+	regs [256]byte
+	ptr  byte
+}
+
+func (m *Memory) Write(buf []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(buf) == 0 {
+		return nil
+	}
+	m.ptr = buf[0]
+	for _, b := range buf[1:] {
+		m.regs[m.ptr] = b
+		m.ptr++
+	}
+	return nil
+}
+
+func (m *Memory) Read(buf []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range buf {
+		buf[i] = m.regs[m.ptr]
+		m.ptr++
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package i2csim
+
+import "sync"
+
+// Registers of the PCA9685 the simulation gives a meaning to.
+const (
+	PCA9685_MODE1      = 0x00
+	PCA9685_MODE2      = 0x01
+	PCA9685_ALLCALLADR = 0x05
+	PCA9685_LED0_ON_L  = 0x06
+	PCA9685_PRE_SCALE  = 0xFE
+
+	PCA9685_MODE1_AI    = 1 << 5
+	PCA9685_MODE1_SLEEP = 1 << 4
+)
+
+// PCA9685 is a simulated 16-channel PWM controller. It models the register
+// file with its power-on values, the register auto-increment and the
+// pre-scaler that can only be written while sleeping.
+type PCA9685 struct {
+	mu   sync.Mutex
+	regs [256]byte
+	ptr  byte
+}
+
+// NewPCA9685 returns a controller in its power-on state.
+func NewPCA9685() *PCA9685 {
+	p := &PCA9685{}
+	p.regs[PCA9685_MODE1] = 0x11
+	p.regs[PCA9685_MODE2] = 0x04
+	p.regs[0x02], p.regs[0x03], p.regs[0x04] = 0xE2, 0xE4, 0xE8
+	p.regs[PCA9685_ALLCALLADR] = 0xE0
+	p.regs[PCA9685_PRE_SCALE] = 0x1E
+	return p
+}
+
+// Register returns the content of a register.
+func (p *PCA9685) Register(reg byte) byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.regs[reg]
+}
+
+// Duty returns the duty cycle of channel between 0 and 1.
+func (p *PCA9685) Duty(channel int) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	r := p.regs[PCA9685_LED0_ON_L+4*channel:]
+	on := int(r[1]&0x1F)<<8 | int(r[0])
+	off := int(r[3]&0x1F)<<8 | int(r[2])
+
+	switch {
+	case on&0x1000 != 0:
+		return 1
+	case off&0x1000 != 0:
+		return 0
+	}
+	return float64((off-on+4096)%4096) / 4096
+}
+
+func (p *PCA9685) next() {
+	if p.regs[PCA9685_MODE1]&PCA9685_MODE1_AI != 0 {
+		p.ptr++
+	}
+}
+
+func (p *PCA9685) Write(buf []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(buf) == 0 {
+		return nil
+	}
+
+	p.ptr = buf[0]
+	for _, b := range buf[1:] {
+		if p.ptr != PCA9685_PRE_SCALE || p.regs[PCA9685_MODE1]&PCA9685_MODE1_SLEEP != 0 {
+			p.regs[p.ptr] = b
+		}
+		p.next()
+	}
+	return nil
+}
+
+func (p *PCA9685) Read(buf []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range buf {
+		buf[i] = p.regs[p.ptr]
+		p.next()
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package i2csim
+
+import "sync"
+
+// PCF8574 is a simulated 8-bit port expander. Its pins are quasi
+// bidirectional: a pin written high reads high unless something outside
+// pulls it low.
+type PCF8574 struct {
+	// OnWrite is called with the new port value after every write.
+	OnWrite func(port byte)
+
+	mu   sync.Mutex
+	port byte
+	low  byte
+}
+
+// NewPCF8574 returns an expander in its power-on state with all pins high.
+func NewPCF8574() *PCF8574 {
+	return &PCF8574{port: 0xFF}
+}
+
+// Port returns the value last written.
+func (p *PCF8574) Port() byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.port
+}
+
+// PullLow sets the pins pulled low from outside, e.g. by a pressed button.
+func (p *PCF8574) PullLow(mask byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.low = mask
+}
+
+// Write sets the port, every byte of a transfer is latched in turn.
+func (p *PCF8574) Write(buf []byte) error {
+	if len(buf) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	p.port = buf[len(buf)-1]
+	port, onWrite := p.port, p.OnWrite
+	p.mu.Unlock()
+
+	if onWrite != nil {
+		onWrite(port)
+	}
+	return nil
+}
+
+// Read returns the pin levels for every byte of buf.
+func (p *PCF8574) Read(buf []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range buf {
+		buf[i] = p.port &^ p.low
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package device
+
+import "time"
+
+// AFECalibration is the content of the offset and gain calibration
+// registers of one channel. It can be stored and written back after a power
+// cycle instead of calibrating again.
+type AFECalibration struct {
+	// Offset is OCAL, a 24-bit two's complement value.
+	Offset int32 `json:"offset"`
+	// Gain is GCAL, a 1.23 fixed point value.
+	Gain uint32 `json:"gain"`
+}
+
+// calibrationRegister returns the first OCAL register of a channel, the
+// GCAL registers follow directly.
+func calibrationRegister(channel int) (byte, error) {
+	switch channel {
+	case NAU7802_CHANNEL_1:
+		return NAU7802_OCAL1_B2, nil
+	case NAU7802_CHANNEL_2:
+		return NAU7802_OCAL2_B2, nil
+	}
+	return 0, ErrInvalidChannel
+}
+
+// ReadAFECalibration reads OCAL and GCAL of one of the NAU7802_CHANNEL_*
+// channels.
+func (n *NAU7802) ReadAFECalibration(channel int) (AFECalibration, error) {
+	reg, err := calibrationRegister(channel)
+	if err != nil {
+		return AFECalibration{}, err
+	}
+
+	buf, err := n.readBlock(reg, reg+6)
+	if err != nil {
+		return AFECalibration{}, err
+	}
+
+	return AFECalibration{
+		Offset: decodeReading(buf[0:3]),
+		Gain:   uint32(buf[3])<<24 | uint32(buf[4])<<16 | uint32(buf[5])<<8 | uint32(buf[6]),
+	}, nil
+}
+
+// WriteAFECalibration restores OCAL and GCAL of one of the NAU7802_CHANNEL_*
+// channels.
+func (n *NAU7802) WriteAFECalibration(channel int, c AFECalibration) error {
+	reg, err := calibrationRegister(channel)
+	if err != nil {
+		return err
+	}
+
+	if c.Offset < NAU7802_ADC_MIN || c.Offset > NAU7802_ADC_MAX {
+		return ErrInvalidOffset
+	}
+
+	return n.SetRegister(reg, []byte{
+		byte(c.Offset >> 16), byte(c.Offset >> 8), byte(c.Offset),
+		byte(c.Gain >> 24), byte(c.Gain >> 16), byte(c.Gain >> 8), byte(c.Gain),
+	})
+}
+
+// CalibrationStatus returns NAU7802_CAL_IN_PROGRESS while a calibration
+// runs, NAU7802_CAL_FAILURE if the last one failed and NAU7802_CAL_SUCCESS
+// otherwise.
+func (n *NAU7802) CalibrationStatus() (int, error) {
+	buf, err := n.GetRegister(NAU7802_CTRL2)
+	if err != nil {
+		return NAU7802_CAL_FAILURE, err
+	}
+
+	switch {
+	case buf[0]&(1<<NAU7802_CTRL2_CALS) != 0:
+		return NAU7802_CAL_IN_PROGRESS, nil
+	case buf[0]&(1<<NAU7802_CTRL2_CAL_ERROR) != 0:
+		return NAU7802_CAL_FAILURE, nil
+	}
+	return NAU7802_CAL_SUCCESS, nil
+}
+
+// BeginCalibrateAFEMode selects one of the NAU7802_CALMOD_* modes and
+// starts the calibration of the selected channel. For NAU7802_CALMOD_OFFSET
+// the inputs have to be at zero, i.e. the empty scale, for
+// NAU7802_CALMOD_GAIN at full scale.
+func (n *NAU7802) BeginCalibrateAFEMode(mode int) error {
+	switch mode {
+	case NAU7802_CALMOD_INTERNAL, NAU7802_CALMOD_OFFSET, NAU7802_CALMOD_GAIN:
+	default:
+		return ErrInvalidCalibrationMode
+	}
+
+	mask := byte(0b11 | 1<<NAU7802_CTRL2_CALS)
+	return n.update(NAU7802_CTRL2, mask, uint8(mode)|1<<NAU7802_CTRL2_CALS)
+}
+
+// CalibrateAFEMode runs a calibration in one of the NAU7802_CALMOD_* modes
+// and waits for its result.
+func (n *NAU7802) CalibrateAFEMode(mode int) error {
+	if err := n.BeginCalibrateAFEMode(mode); err != nil {
+		return err
+	}
+
+	return n.WaitForCalibrateAFE(n.calibrationTimeout())
+}
+
+// CalibrateAFE runs the internal offset calibration.
+func (n *NAU7802) CalibrateAFE() error {
+	return n.CalibrateAFEMode(NAU7802_CALMOD_INTERNAL)
+}
+
+func (n *NAU7802) BeginCalibrateAFE() error {
+	return n.BeginCalibrateAFEMode(NAU7802_CALMOD_INTERNAL)
+}
+
+// CalAFEInProgress reports whether a calibration is running. A failed
+// calibration is reported as ErrCalibration.
+func (n *NAU7802) CalAFEInProgress() (bool, error) {
+	status, err := n.CalibrationStatus()
+	if err != nil {
+		return false, err
+	}
+
+	switch status {
+	case NAU7802_CAL_IN_PROGRESS:
+		return true, nil
+	case NAU7802_CAL_FAILURE:
+		return false, ErrCalibration
+	}
+	return false, nil
+}
+
+// WaitForCalibrateAFE waits until the running calibration finished. It
+// returns ErrCalibration if the chip reports CAL_ERROR and ErrTimeout if
+// CALS is still set after timeout.
+func (n *NAU7802) WaitForCalibrateAFE(timeout time.Duration) error {
+	return poll(timeout, func() (bool, error) {
+		inProgress, err := n.CalAFEInProgress()
+		return !inProgress, err
+	})
+}
+
+func (n *NAU7802) calibrationTimeout() time.Duration {
+	if n.timeouts.Calibration > 0 {
+		return n.timeouts.Calibration
+	}
+
+	timeout := 10 * ConversionTime(n.sampleRate)
+	if timeout < 100*time.Millisecond {
+		timeout = 100 * time.Millisecond
+	}
+	return timeout
+}
@@ -0,0 +1,182 @@
+package device_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/sim"
+)
+
+func TestInitializeCalibration(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(chip *sim.NAU7802)
+		err    error
+		status int
+	}{
+		{"success", nil, nil, device.NAU7802_CAL_SUCCESS},
+		{"CAL_ERROR", func(chip *sim.NAU7802) { chip.CalibrationError = true }, device.ErrCalibration, device.NAU7802_CAL_FAILURE},
+		{"timeout", func(chip *sim.NAU7802) { chip.StuckCalibration = true }, device.ErrTimeout, device.NAU7802_CAL_IN_PROGRESS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chip := sim.New()
+			if tt.setup != nil {
+				tt.setup(chip)
+			}
+			nau7802 := device.New(chip)
+			timeouts := nau7802.GetTimeouts()
+			timeouts.Calibration = 100 * time.Millisecond
+			nau7802.SetTimeouts(timeouts)
+
+			if err := nau7802.Initialize(); !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			status, err := nau7802.CalibrationStatus()
+			if err != nil || status != tt.status {
+				t.Errorf("calibration status %d, %v, want %d", status, err, tt.status)
+			}
+		})
+	}
+}
+
+func TestCalibrateAFEWaits(t *testing.T) {
+	_, nau7802 := initialized(t, func(chip *sim.NAU7802) {
+		chip.CalibrationTime = 50 * time.Millisecond
+	})
+
+	start := time.Now()
+	if err := nau7802.CalibrateAFE(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("returned after %v, before the calibration finished", elapsed)
+	}
+}
+
+func TestAFECalibrationRoundTrip(t *testing.T) {
+	tests := []struct {
+		cal  device.AFECalibration
+		ocal [3]byte
+	}{
+		{device.AFECalibration{Offset: 0, Gain: device.NAU7802_GCAL_DEFAULT}, [3]byte{0, 0, 0}},
+		{device.AFECalibration{Offset: -1, Gain: 0xFFFFFFFF}, [3]byte{0xFF, 0xFF, 0xFF}},
+		{device.AFECalibration{Offset: -123456, Gain: 0x00C00000}, [3]byte{0xFE, 0x1D, 0xC0}},
+		{device.AFECalibration{Offset: device.NAU7802_ADC_MIN, Gain: 0}, [3]byte{0x80, 0, 0}},
+		{device.AFECalibration{Offset: device.NAU7802_ADC_MAX, Gain: 0x80000000}, [3]byte{0x7F, 0xFF, 0xFF}},
+	}
+
+	for _, channel := range []int{device.NAU7802_CHANNEL_1, device.NAU7802_CHANNEL_2} {
+		other := 1 - channel
+		reg := byte(device.NAU7802_OCAL1_B2)
+		if channel == device.NAU7802_CHANNEL_2 {
+			reg = device.NAU7802_OCAL2_B2
+		}
+
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("channel %d %+v", channel+1, tt.cal), func(t *testing.T) {
+				chip, nau7802 := initialized(t, nil)
+				before, err := nau7802.ReadAFECalibration(other)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err = nau7802.WriteAFECalibration(channel, tt.cal); err != nil {
+					t.Fatal(err)
+				}
+				for i, b := range tt.ocal {
+					if got := chip.Register(reg + byte(i)); got != b {
+						t.Errorf("OCAL byte %d is %#02x, want %#02x", i, got, b)
+					}
+				}
+
+				got, err := nau7802.ReadAFECalibration(channel)
+				if err != nil || got != tt.cal {
+					t.Errorf("read back %+v, %v, want %+v", got, err, tt.cal)
+				}
+				if after, _ := nau7802.ReadAFECalibration(other); after != before {
+					t.Errorf("other channel changed from %+v to %+v", before, after)
+				}
+			})
+		}
+	}
+
+	_, nau7802 := initialized(t, nil)
+	if err := nau7802.WriteAFECalibration(device.NAU7802_CHANNEL_1, device.AFECalibration{Offset: 1 << 23}); !errors.Is(err, device.ErrInvalidOffset) {
+		t.Errorf("offset out of range got %v, want %v", err, device.ErrInvalidOffset)
+	}
+	if _, err := nau7802.ReadAFECalibration(2); !errors.Is(err, device.ErrInvalidChannel) {
+		t.Errorf("channel 2 got %v, want %v", err, device.ErrInvalidChannel)
+	}
+}
+
+func TestCalibrateAFEMode(t *testing.T) {
+	const zero, span = 5000, 100000
+
+	chip, nau7802 := initialized(t, func(chip *sim.NAU7802) {
+		chip.SetRaw(device.NAU7802_CHANNEL_1, zero)
+	})
+
+	// system offset with the empty scale
+	if err := nau7802.CalibrateAFEMode(device.NAU7802_CALMOD_OFFSET); err != nil {
+		t.Fatal(err)
+	}
+	cal, err := nau7802.ReadAFECalibration(device.NAU7802_CHANNEL_1)
+	if err != nil || cal.Offset != zero {
+		t.Fatalf("OCAL %d, %v after the offset calibration, want %d", cal.Offset, err, zero)
+	}
+	if raw, err := nau7802.GetNextReading(); err != nil || raw != 0 {
+		t.Errorf("empty scale reads %d, %v, want 0", raw, err)
+	}
+
+	// system gain at full scale
+	chip.SetRaw(device.NAU7802_CHANNEL_1, zero+span)
+	if err = nau7802.CalibrateAFEMode(device.NAU7802_CALMOD_GAIN); err != nil {
+		t.Fatal(err)
+	}
+	want := uint32(int64(device.NAU7802_GCAL_DEFAULT) * device.NAU7802_ADC_MAX / span)
+	if cal, err = nau7802.ReadAFECalibration(device.NAU7802_CHANNEL_1); err != nil || cal.Gain != want {
+		t.Errorf("GCAL %#x, %v after the gain calibration, want %#x", cal.Gain, err, want)
+	}
+}
+
+func TestCalibrateAFEModeError(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(chip *sim.NAU7802)
+		mode  int
+	}{
+		{"CAL_ERROR", func(chip *sim.NAU7802) { chip.CalibrationError = true }, device.NAU7802_CALMOD_OFFSET},
+		{"no span for the gain", nil, device.NAU7802_CALMOD_GAIN},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chip, nau7802 := initialized(t, nil)
+			if tt.setup != nil {
+				tt.setup(chip)
+			}
+			before, _ := nau7802.ReadAFECalibration(device.NAU7802_CHANNEL_1)
+
+			if err := nau7802.CalibrateAFEMode(tt.mode); !errors.Is(err, device.ErrCalibration) {
+				t.Fatalf("got %v, want %v", err, device.ErrCalibration)
+			}
+			if status, err := nau7802.CalibrationStatus(); err != nil || status != device.NAU7802_CAL_FAILURE {
+				t.Errorf("calibration status %d, %v, want %d", status, err, device.NAU7802_CAL_FAILURE)
+			}
+			if after, _ := nau7802.ReadAFECalibration(device.NAU7802_CHANNEL_1); after != before {
+				t.Errorf("failed calibration changed %+v to %+v", before, after)
+			}
+
+			// the next calibration starts with CAL_ERR cleared
+			chip.CalibrationError = false
+			if err := nau7802.CalibrateAFEMode(device.NAU7802_CALMOD_INTERNAL); err != nil {
+				t.Errorf("calibration after the failed one: %v", err)
+			}
+		})
+	}
+}
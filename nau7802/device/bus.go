@@ -0,0 +1,9 @@
+package device
+
+// Bus is the register level access the driver needs. *i2c.Device from
+// golang.org/x/exp/io/i2c satisfies it, reads and writes of more than one
+// byte use the auto-increment of the register address.
+type Bus interface {
+	ReadReg(reg byte, buf []byte) error
+	WriteReg(reg byte, buf []byte) error
+}
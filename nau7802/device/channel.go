@@ -0,0 +1,119 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/SimonWaldherr/rpi-examples/calibration"
+)
+
+// Calibration converts the raw readings of one channel to a weight.
+type Calibration struct {
+	ZeroOffset        int32   `json:"zero_offset"`
+	CalibrationFactor float64 `json:"calibration_factor"`
+
+	// Curve is set by a multi-point calibration and replaces the
+	// CalibrationFactor for the weight conversion.
+	Curve *calibration.Curve `json:"curve,omitempty"`
+
+	// AFE holds the calibration registers of the chip. If set they are
+	// restored on initialization instead of running a calibration.
+	AFE *AFECalibration `json:"afe,omitempty"`
+
+	// TempCoefficient is the drift of the reading in counts per °C away
+	// from ReferenceTemp. Readings are compensated once the temperature
+	// was read.
+	TempCoefficient float64 `json:"temp_coefficient,omitempty"`
+	ReferenceTemp   float64 `json:"reference_temp,omitempty"`
+}
+
+// Weight converts a raw reading with the curve if set, otherwise with the
+// calibration factor.
+func (c Calibration) Weight(raw int32) float64 {
+	if c.Curve != nil {
+		return c.Curve.Weight(float64(raw - c.ZeroOffset))
+	}
+	return float64(raw-c.ZeroOffset) / c.CalibrationFactor
+}
+
+// Compensate removes the temperature drift from a raw reading taken at
+// celsius.
+func (c Calibration) Compensate(raw int32, celsius float64) int32 {
+	if c.TempCoefficient == 0 {
+		return raw
+	}
+	return raw - int32(math.Round(c.TempCoefficient*(celsius-c.ReferenceTemp)))
+}
+
+// Validate checks that the calibration converts readings to finite values.
+func (c Calibration) Validate() error {
+	if math.IsNaN(c.TempCoefficient) || math.IsInf(c.TempCoefficient, 0) {
+		return fmt.Errorf("nau7802: invalid temperature coefficient %v", c.TempCoefficient)
+	}
+	if c.Curve != nil {
+		return c.Curve.Validate()
+	}
+	if c.CalibrationFactor == 0 || math.IsNaN(c.CalibrationFactor) || math.IsInf(c.CalibrationFactor, 0) {
+		return fmt.Errorf("nau7802: invalid calibration factor %v", c.CalibrationFactor)
+	}
+	return nil
+}
+
+// SetChannelCalibration sets the calibration of one of the NAU7802_CHANNEL_*
+// channels independent of the selected one.
+func (n *NAU7802) SetChannelCalibration(channel int, c Calibration) error {
+	if channel != NAU7802_CHANNEL_1 && channel != NAU7802_CHANNEL_2 {
+		return ErrInvalidChannel
+	}
+	n.cal[channel] = c
+	return nil
+}
+
+func (n *NAU7802) GetChannelCalibration(channel int) Calibration {
+	return n.cal[channel&1]
+}
+
+// SetSettleConversions sets how many conversions are discarded after a
+// channel switch, the default is 1.
+func (n *NAU7802) SetSettleConversions(conversions int) {
+	if conversions < 0 {
+		conversions = 0
+	}
+	n.settle = conversions
+}
+
+// ReadChannels reads one conversion from each channel, switching between
+// them and discarding the settling conversions. The samples are indexed by
+// NAU7802_CHANNEL_*. The selected channel is read first to save a switch.
+//
+// When both channels carry a bridge, PGA_CAP_EN has to be off because the
+// capacitor of that option sits on the channel 2 inputs.
+func (n *NAU7802) ReadChannels() ([2]Sample, error) {
+	var samples [2]Sample
+
+	first := n.channel
+	for _, channel := range []int{first, 1 - first} {
+		if err := n.SetChannel(channel); err != nil {
+			return samples, err
+		}
+
+		samples[channel] = n.nextSample()
+		if samples[channel].Err != nil {
+			return samples, samples[channel].Err
+		}
+	}
+
+	return samples, nil
+}
+
+// StreamChannels is like Stream but alternates between both channels, every
+// sample carries the channel it was taken from.
+func (n *NAU7802) StreamChannels(ctx context.Context) <-chan Sample {
+	return n.stream(ctx, func() Sample {
+		if err := n.SetChannel(1 - n.channel); err != nil {
+			return Sample{Channel: 1 - n.channel, Err: err}
+		}
+		return n.nextSample()
+	})
+}
@@ -0,0 +1,129 @@
+package device_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/sim"
+)
+
+// settling is a simulated chip whose first settle conversions after a
+// channel switch read unsettled.
+type settling struct {
+	*sim.NAU7802
+	settle int
+
+	pending     int
+	conversions int
+}
+
+// unsettled is the reading of a conversion that did not settle.
+const unsettled = 0x400000
+
+func (s *settling) WriteReg(reg byte, buf []byte) error {
+	if reg == device.NAU7802_CTRL2 && len(buf) > 0 {
+		const chs = 1 << device.NAU7802_CTRL2_CHS
+		if (s.Register(reg)^buf[0])&chs != 0 {
+			s.pending = s.settle
+		}
+	}
+	return s.NAU7802.WriteReg(reg, buf)
+}
+
+func (s *settling) ReadReg(reg byte, buf []byte) error {
+	if err := s.NAU7802.ReadReg(reg, buf); err != nil || reg != device.NAU7802_ADCO_B2 {
+		return err
+	}
+
+	s.conversions++
+	if s.pending > 0 {
+		s.pending--
+		buf[0], buf[1], buf[2] = unsettled>>16, 0, 0
+	}
+	return nil
+}
+
+// twoChannels returns a driver on a chip with a bridge on each channel that
+// discards settle conversions after a switch.
+func twoChannels(t *testing.T, settle int) (*settling, *device.NAU7802) {
+	t.Helper()
+
+	chip := &settling{NAU7802: sim.New()}
+	chip.SetRaw(device.NAU7802_CHANNEL_1, 1000)
+	chip.SetRaw(device.NAU7802_CHANNEL_2, -2000)
+
+	nau7802 := device.New(chip)
+	if err := nau7802.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	nau7802.SetSettleConversions(settle)
+	chip.settle = settle
+	return chip, nau7802
+}
+
+var channelRaw = [2]int32{1000, -2000}
+
+func TestReadChannels(t *testing.T) {
+	for _, settle := range []int{0, 1, 2} {
+		t.Run(fmt.Sprintf("settle %d", settle), func(t *testing.T) {
+			chip, nau7802 := twoChannels(t, settle)
+
+			// channel 1 is selected and read first, the second read of
+			// both starts on channel 2
+			for i, last := range []int{device.NAU7802_CHANNEL_2, device.NAU7802_CHANNEL_1} {
+				chip.conversions = 0
+
+				samples, err := nau7802.ReadChannels()
+				if err != nil {
+					t.Fatal(err)
+				}
+				for channel, sample := range samples {
+					if sample.Channel != channel || sample.Raw != channelRaw[channel] {
+						t.Errorf("read %d: channel %d got channel %d raw %d, want raw %d", i, channel, sample.Channel, sample.Raw, channelRaw[channel])
+					}
+				}
+
+				if want := 2 + settle; chip.conversions != want {
+					t.Errorf("read %d: %d conversions read, want %d", i, chip.conversions, want)
+				}
+				chs := chip.Register(device.NAU7802_CTRL2)>>device.NAU7802_CTRL2_CHS&1 == 1
+				if chs != (last == device.NAU7802_CHANNEL_2) || nau7802.GetChannel() != last {
+					t.Errorf("read %d: CHS %v, channel %d, want channel %d selected", i, chs, nau7802.GetChannel(), last)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamChannels(t *testing.T) {
+	chip, nau7802 := twoChannels(t, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	samples := nau7802.StreamChannels(ctx)
+	last := -1
+	for i := 0; i < 6; i++ {
+		sample := <-samples
+		if sample.Err != nil {
+			t.Fatal(sample.Err)
+		}
+		if sample.Channel == last {
+			t.Errorf("sample %d: channel %d twice in a row", i, sample.Channel)
+		}
+		if sample.Raw != channelRaw[sample.Channel] {
+			t.Errorf("sample %d: channel %d raw %d, want %d", i, sample.Channel, sample.Raw, channelRaw[sample.Channel])
+		}
+		last = sample.Channel
+	}
+
+	cancel()
+	for range samples {
+	}
+	// every switch discarded one conversion
+	if chip.conversions < 12 {
+		t.Errorf("%d conversions read for 6 samples, want 12 or more", chip.conversions)
+	}
+}
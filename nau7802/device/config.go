@@ -0,0 +1,312 @@
+package device
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Config is the complete analog front-end configuration: every option of
+// the PU_CTRL, CTRL1, CTRL2, I2C_CONTROL, ADC, PGA and PGA_PWR registers
+// that is not a command or a status. Gain, sample rate, channel and LDO
+// voltage are given in their natural units like in the Profile.
+type Config struct {
+	Gain       int     `json:"gain"`
+	SampleRate int     `json:"sample_rate"`
+	Channel    int     `json:"channel"`
+	LDO        float64 `json:"ldo"` // volts, 0 clears AVDDS to use the AVDD pin
+
+	Options
+}
+
+// Options are the less common settings of Config. The JSON names are used
+// by the options section of the Profile, settings missing there keep the
+// value of DefaultOptions.
+type Options struct {
+	// PU_CTRL
+	ExternalClock bool `json:"external_clock,omitempty"` // OSCS
+
+	// CTRL1
+	DRDYClock      bool `json:"drdy_clock,omitempty"`       // DRDY_SEL, DRDY outputs the conversion clock
+	ReadyActiveLow bool `json:"ready_active_low,omitempty"` // CRP
+
+	// I2C_CONTROL
+	BandgapChopperOff bool `json:"bandgap_chopper_off,omitempty"` // BGPCP
+	BurnoutCurrent    bool `json:"burnout_current,omitempty"`     // BOPGA, 2.5µA into the positive input
+	ShortInputs       bool `json:"short_inputs,omitempty"`        // SI
+	WeakPullUpOff     bool `json:"weak_pullup_off,omitempty"`     // WPD
+	StrongPullUp      bool `json:"strong_pullup,omitempty"`       // SPE
+	FastRead          bool `json:"fast_read,omitempty"`           // FRD
+	ReadyOnSDA        bool `json:"ready_on_sda,omitempty"`        // CRSD, SDA is pulled low when a conversion is ready
+
+	// ADC, the datasheet's power-on sequence turns off the chopper clock
+	// with REG_CHP 0b11
+	ChopperClock  int `json:"chopper_clock"`            // REG_CHP
+	CommonMode    int `json:"common_mode,omitempty"`    // ADC_VCM
+	ChopFrequency int `json:"chop_frequency,omitempty"` // REG_CHPS
+
+	// PGA
+	PGAChopperOff bool `json:"pga_chopper_off,omitempty"` // CHP_DIS
+	InvertInput   bool `json:"invert_input,omitempty"`    // INV
+	PGABypass     bool `json:"pga_bypass,omitempty"`      // BYPASS_EN
+	PGAOutput     bool `json:"pga_output,omitempty"`      // OUT_EN, PGA output buffer
+	PGAStableLDO  bool `json:"pga_stable_ldo,omitempty"`  // LDOMODE, stability over DC gain
+
+	// PGA_PWR
+	PGACurrent        int  `json:"pga_current,omitempty"`         // PGA_CURR
+	ADCCurrent        int  `json:"adc_current,omitempty"`         // ADC_CURR
+	MasterBiasCurrent int  `json:"master_bias_current,omitempty"` // MSTR_BIAS_CURR
+	PGACapacitor      bool `json:"pga_capacitor"`                 // PGA_CAP_EN
+}
+
+// ConfigMismatchError lists the settings the chip does not have after
+// Configure.
+type ConfigMismatchError struct {
+	Fields []string
+}
+
+func (e *ConfigMismatchError) Error() string {
+	return "nau7802: configuration mismatch: " + strings.Join(e.Fields, ", ")
+}
+
+// DefaultOptions returns the options Initialize has always used: the
+// chopper clock off and the PGA output capacitor enabled.
+func DefaultOptions() Options {
+	return Options{
+		ChopperClock: 0b11,
+		PGACapacitor: true,
+	}
+}
+
+// Validate checks the configuration against the constraints of the
+// datasheet.
+func (c Config) Validate() error {
+	if _, err := GainCode(c.Gain); err != nil {
+		return err
+	}
+	if _, err := SampleRateCode(c.SampleRate); err != nil {
+		return err
+	}
+	if _, err := ChannelCode(c.Channel); err != nil {
+		return err
+	}
+	if c.LDO != 0 {
+		if _, err := LDOCode(c.LDO); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range []struct {
+		name       string
+		value, max int
+	}{
+		{"chopper clock", c.ChopperClock, 3},
+		{"common mode", c.CommonMode, 3},
+		{"chop frequency", c.ChopFrequency, 3},
+		{"PGA current", c.PGACurrent, 3},
+		{"ADC current", c.ADCCurrent, 3},
+		{"master bias current", c.MasterBiasCurrent, 7},
+	} {
+		if f.value < 0 || f.value > f.max {
+			return fmt.Errorf("nau7802: %s %d out of range 0 to %d", f.name, f.value, f.max)
+		}
+	}
+
+	// the capacitor is connected across the channel 2 inputs
+	if c.PGACapacitor && c.Channel == 2 {
+		return fmt.Errorf("nau7802: the PGA capacitor can not be enabled while channel 2 is used")
+	}
+	// with the PGA bypassed the input goes straight to the ADC
+	if c.PGABypass && c.Gain != 1 {
+		return fmt.Errorf("nau7802: the PGA bypass needs a gain of 1, not %d", c.Gain)
+	}
+	if c.PGAOutput && !c.PGACapacitor {
+		return fmt.Errorf("nau7802: the PGA output buffer needs the PGA capacitor")
+	}
+
+	return nil
+}
+
+func setBit(reg *byte, b uint, value bool) {
+	if value {
+		*reg |= 1 << b
+	}
+}
+
+func getBit(reg byte, b uint) bool {
+	return reg&(1<<b) != 0
+}
+
+// Configure validates c and writes all configuration registers. The power
+// bits of PU_CTRL are kept, the calibration mode, the temperature sensor
+// and the OTP selection are cleared.
+func (n *NAU7802) Configure(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	// Validate made sure the conversions succeed
+	gain, _ := GainCode(c.Gain)
+	rate, _ := SampleRateCode(c.SampleRate)
+	channel, _ := ChannelCode(c.Channel)
+	ldo := NAU7802_LDO_4V5
+	if c.LDO != 0 {
+		ldo, _ = LDOCode(c.LDO)
+	}
+
+	puCtrl, err := n.register(NAU7802_PU_CTRL)
+	if err != nil {
+		return err
+	}
+
+	pu := puCtrl & (1<<NAU7802_PU_CTRL_PUD | 1<<NAU7802_PU_CTRL_PUA | 1<<NAU7802_PU_CTRL_CS)
+	setBit(&pu, NAU7802_PU_CTRL_OSCS, c.ExternalClock)
+	setBit(&pu, NAU7802_PU_CTRL_AVDDS, c.LDO != 0)
+
+	ctrl1 := byte(gain) | byte(ldo)<<ldoField.Bit
+	setBit(&ctrl1, NAU7802_CTRL1_DRDY_SEL, c.DRDYClock)
+	setBit(&ctrl1, NAU7802_CTRL1_CRP, c.ReadyActiveLow)
+
+	ctrl2 := byte(rate) << NAU7802_CTRL2_CRS
+	setBit(&ctrl2, NAU7802_CTRL2_CHS, channel == NAU7802_CHANNEL_2)
+
+	var i2c byte
+	setBit(&i2c, NAU7802_I2C_CONTROL_BGPCP, c.BandgapChopperOff)
+	setBit(&i2c, NAU7802_I2C_CONTROL_BOPGA, c.BurnoutCurrent)
+	setBit(&i2c, NAU7802_I2C_CONTROL_SI, c.ShortInputs)
+	setBit(&i2c, NAU7802_I2C_CONTROL_WPD, c.WeakPullUpOff)
+	setBit(&i2c, NAU7802_I2C_CONTROL_SPE, c.StrongPullUp)
+	setBit(&i2c, NAU7802_I2C_CONTROL_FRD, c.FastRead)
+	setBit(&i2c, NAU7802_I2C_CONTROL_CRSD, c.ReadyOnSDA)
+
+	adc := byte(c.ChopperClock)<<NAU7802_ADC_REG_CHP | byte(c.CommonMode)<<NAU7802_ADC_ADC_VCM | byte(c.ChopFrequency)<<NAU7802_ADC_REG_CHPS
+
+	var pga byte
+	setBit(&pga, NAU7802_PGA_CHP_DIS, c.PGAChopperOff)
+	setBit(&pga, NAU7802_PGA_INV, c.InvertInput)
+	setBit(&pga, NAU7802_PGA_BYPASS_EN, c.PGABypass)
+	setBit(&pga, NAU7802_PGA_OUT_EN, c.PGAOutput)
+	setBit(&pga, NAU7802_PGA_LDOMODE, c.PGAStableLDO)
+
+	pgaPwr := byte(c.PGACurrent)<<NAU7802_PGA_PWR_PGA_CURR | byte(c.ADCCurrent)<<NAU7802_PGA_PWR_ADC_CURR | byte(c.MasterBiasCurrent)<<NAU7802_PGA_PWR_MSTR_BIAS_CURR
+	setBit(&pgaPwr, NAU7802_PGA_PWR_PGA_CAP_EN, c.PGACapacitor)
+
+	// consecutive registers are written together
+	for _, w := range []struct {
+		reg    byte
+		values []byte
+	}{
+		{NAU7802_PU_CTRL, []byte{pu, ctrl1, ctrl2}},
+		{NAU7802_I2C_CONTROL, []byte{i2c}},
+		{NAU7802_ADC, []byte{adc}},
+		{NAU7802_PGA, []byte{pga, pgaPwr}},
+	} {
+		if err = n.SetRegister(w.reg, w.values); err != nil {
+			return err
+		}
+	}
+
+	n.sampleRate = rate
+	if channel != n.channel {
+		n.discard = n.settle
+	}
+	n.channel = channel
+
+	return nil
+}
+
+// ReadConfig reads the configuration registers back from the chip.
+func (n *NAU7802) ReadConfig() (Config, error) {
+	regs := make(map[byte]byte)
+	for _, block := range [][2]byte{
+		{NAU7802_PU_CTRL, NAU7802_CTRL2},
+		{NAU7802_I2C_CONTROL, NAU7802_I2C_CONTROL},
+		{NAU7802_ADC, NAU7802_ADC},
+		{NAU7802_PGA, NAU7802_PGA_PWR},
+	} {
+		values, err := n.readBlock(block[0], block[1])
+		if err != nil {
+			return Config{}, err
+		}
+		for i, v := range values {
+			regs[block[0]+byte(i)] = v
+		}
+	}
+
+	pu, ctrl1, ctrl2 := regs[NAU7802_PU_CTRL], regs[NAU7802_CTRL1], regs[NAU7802_CTRL2]
+	i2c, adc, pga, pgaPwr := regs[NAU7802_I2C_CONTROL], regs[NAU7802_ADC], regs[NAU7802_PGA], regs[NAU7802_PGA_PWR]
+
+	c := Config{
+		Gain:       1 << gainField.Value(ctrl1),
+		SampleRate: SamplesPerSecond(int(rateField.Value(ctrl2))),
+		Channel:    int(ctrl2>>NAU7802_CTRL2_CHS&1) + 1,
+	}
+	if getBit(pu, NAU7802_PU_CTRL_AVDDS) {
+		c.LDO = 4.5 - 0.3*float64(ldoField.Value(ctrl1))
+	}
+
+	c.ExternalClock = getBit(pu, NAU7802_PU_CTRL_OSCS)
+	c.DRDYClock = getBit(ctrl1, NAU7802_CTRL1_DRDY_SEL)
+	c.ReadyActiveLow = getBit(ctrl1, NAU7802_CTRL1_CRP)
+
+	c.BandgapChopperOff = getBit(i2c, NAU7802_I2C_CONTROL_BGPCP)
+	c.BurnoutCurrent = getBit(i2c, NAU7802_I2C_CONTROL_BOPGA)
+	c.ShortInputs = getBit(i2c, NAU7802_I2C_CONTROL_SI)
+	c.WeakPullUpOff = getBit(i2c, NAU7802_I2C_CONTROL_WPD)
+	c.StrongPullUp = getBit(i2c, NAU7802_I2C_CONTROL_SPE)
+	c.FastRead = getBit(i2c, NAU7802_I2C_CONTROL_FRD)
+	c.ReadyOnSDA = getBit(i2c, NAU7802_I2C_CONTROL_CRSD)
+
+	c.ChopperClock = int(adc>>NAU7802_ADC_REG_CHP) & 0b11
+	c.CommonMode = int(adc>>NAU7802_ADC_ADC_VCM) & 0b11
+	c.ChopFrequency = int(adc>>NAU7802_ADC_REG_CHPS) & 0b11
+
+	c.PGAChopperOff = getBit(pga, NAU7802_PGA_CHP_DIS)
+	c.InvertInput = getBit(pga, NAU7802_PGA_INV)
+	c.PGABypass = getBit(pga, NAU7802_PGA_BYPASS_EN)
+	c.PGAOutput = getBit(pga, NAU7802_PGA_OUT_EN)
+	c.PGAStableLDO = getBit(pga, NAU7802_PGA_LDOMODE)
+
+	c.PGACurrent = int(pgaPwr>>NAU7802_PGA_PWR_PGA_CURR) & 0b11
+	c.ADCCurrent = int(pgaPwr>>NAU7802_PGA_PWR_ADC_CURR) & 0b11
+	c.MasterBiasCurrent = int(pgaPwr>>NAU7802_PGA_PWR_MSTR_BIAS_CURR) & 0b111
+	c.PGACapacitor = getBit(pgaPwr, NAU7802_PGA_PWR_PGA_CAP_EN)
+
+	return c, nil
+}
+
+// VerifyConfig reads the configuration back and returns a
+// *ConfigMismatchError naming every setting that differs from c.
+func (n *NAU7802) VerifyConfig(c Config) error {
+	got, err := n.ReadConfig()
+	if err != nil {
+		return err
+	}
+
+	var fields []string
+	diff := func(name string, got, want interface{}) {
+		if got != want {
+			fields = append(fields, fmt.Sprintf("%s is %v, want %v", name, got, want))
+		}
+	}
+
+	// the LDO is compared by its register code
+	gotLDO, _ := LDOCode(got.LDO)
+	wantLDO, _ := LDOCode(c.LDO)
+
+	diff("gain", got.Gain, c.Gain)
+	diff("sample rate", got.SampleRate, c.SampleRate)
+	diff("channel", got.Channel, c.Channel)
+	diff("AVDDS", got.LDO != 0, c.LDO != 0)
+	diff("LDO code", gotLDO, wantLDO)
+
+	gotOpts, wantOpts := reflect.ValueOf(got.Options), reflect.ValueOf(c.Options)
+	for i := 0; i < gotOpts.NumField(); i++ {
+		diff(gotOpts.Type().Field(i).Name, gotOpts.Field(i).Interface(), wantOpts.Field(i).Interface())
+	}
+
+	if len(fields) > 0 {
+		return &ConfigMismatchError{Fields: fields}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package device_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+)
+
+func TestConfigure(t *testing.T) {
+	_, nau7802 := initialized(t, nil)
+
+	config := device.DefaultProfile().Config()
+	config.Gain = 1
+	config.PGABypass = true
+	config.PGAStableLDO = true
+	config.ADCCurrent = 2
+	config.StrongPullUp = true
+	if err := nau7802.Configure(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := nau7802.VerifyConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Gain = 128
+	if nau7802.Configure(config) == nil {
+		t.Error("PGA bypass with a gain of 128 was accepted")
+	}
+
+	var mismatch *device.ConfigMismatchError
+	if !errors.As(nau7802.VerifyConfig(config), &mismatch) || len(mismatch.Fields) != 1 {
+		t.Errorf("read-back did not report the gain: %v", mismatch)
+	}
+}
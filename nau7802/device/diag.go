@@ -0,0 +1,300 @@
+package device
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field is a bit field of a register, Bit is its lowest bit.
+type Field struct {
+	Name  string
+	Bit   uint
+	Width uint
+	// describe returns the meaning of a field value, if there is one
+	describe func(v byte) string
+}
+
+// Value extracts the field from the register value.
+func (f Field) Value(reg byte) byte {
+	return reg >> f.Bit & (1<<f.Width - 1)
+}
+
+// Format returns NAME=value, followed by the decoded meaning if there is
+// one.
+func (f Field) Format(reg byte) string {
+	v := f.Value(reg)
+	if f.describe != nil {
+		return fmt.Sprintf("%s=%d(%s)", f.Name, v, f.describe(v))
+	}
+	return fmt.Sprintf("%s=%d", f.Name, v)
+}
+
+// RegisterInfo describes one register of the register map.
+type RegisterInfo struct {
+	Address byte
+	Name    string
+	Fields  []Field
+}
+
+// RegisterValue is the content of a register read by DumpRegisters.
+type RegisterValue struct {
+	RegisterInfo
+	Value byte
+}
+
+// Decode returns the formatted fields of the register, from the highest
+// bit down. Registers that are part of a multi-byte value have no fields.
+func (r RegisterValue) Decode() string {
+	fields := make([]string, len(r.Fields))
+	for i, f := range r.Fields {
+		fields[len(r.Fields)-1-i] = f.Format(r.Value)
+	}
+	return strings.Join(fields, " ")
+}
+
+func bit(name string, b uint) Field {
+	return Field{Name: name, Bit: b, Width: 1}
+}
+
+func describeGain(v byte) string {
+	return fmt.Sprintf("x%d", 1<<v)
+}
+
+func describeLDO(v byte) string {
+	return fmt.Sprintf("%.1fV", 4.5-0.3*float64(v))
+}
+
+func describeRate(v byte) string {
+	if sps := SamplesPerSecond(int(v)); sps != 0 {
+		return fmt.Sprintf("%d SPS", sps)
+	}
+	return "reserved"
+}
+
+func describeCalMode(v byte) string {
+	switch v {
+	case NAU7802_CALMOD_INTERNAL:
+		return "internal"
+	case NAU7802_CALMOD_OFFSET:
+		return "offset"
+	case NAU7802_CALMOD_GAIN:
+		return "gain"
+	}
+	return "reserved"
+}
+
+// The GAIN and VLDO constants name the highest bit of their field.
+var (
+	gainField = Field{Name: "GAIN", Bit: NAU7802_CTRL1_GAIN - 2, Width: 3, describe: describeGain}
+	ldoField  = Field{Name: "VLDO", Bit: NAU7802_CTRL1_VLDO - 2, Width: 3, describe: describeLDO}
+	rateField = Field{Name: "CRS", Bit: NAU7802_CTRL2_CRS, Width: 3, describe: describeRate}
+)
+
+// Registers is the register map of the NAU7802 from PU_CTRL to DEVICE_REV.
+var Registers = []RegisterInfo{
+	{NAU7802_PU_CTRL, "PU_CTRL", []Field{
+		bit("RR", NAU7802_PU_CTRL_RR),
+		bit("PUD", NAU7802_PU_CTRL_PUD),
+		bit("PUA", NAU7802_PU_CTRL_PUA),
+		bit("PUR", NAU7802_PU_CTRL_PUR),
+		bit("CS", NAU7802_PU_CTRL_CS),
+		bit("CR", NAU7802_PU_CTRL_CR),
+		bit("OSCS", NAU7802_PU_CTRL_OSCS),
+		bit("AVDDS", NAU7802_PU_CTRL_AVDDS),
+	}},
+	{NAU7802_CTRL1, "CTRL1", []Field{
+		gainField,
+		ldoField,
+		bit("DRDY_SEL", NAU7802_CTRL1_DRDY_SEL),
+		bit("CRP", NAU7802_CTRL1_CRP),
+	}},
+	{NAU7802_CTRL2, "CTRL2", []Field{
+		{Name: "CALMOD", Bit: NAU7802_CTRL2_CALMOD, Width: 2, describe: describeCalMode},
+		bit("CALS", NAU7802_CTRL2_CALS),
+		bit("CAL_ERROR", NAU7802_CTRL2_CAL_ERROR),
+		rateField,
+		bit("CHS", NAU7802_CTRL2_CHS),
+	}},
+	{NAU7802_OCAL1_B2, "OCAL1_B2", nil},
+	{NAU7802_OCAL1_B1, "OCAL1_B1", nil},
+	{NAU7802_OCAL1_B0, "OCAL1_B0", nil},
+	{NAU7802_GCAL1_B3, "GCAL1_B3", nil},
+	{NAU7802_GCAL1_B2, "GCAL1_B2", nil},
+	{NAU7802_GCAL1_B1, "GCAL1_B1", nil},
+	{NAU7802_GCAL1_B0, "GCAL1_B0", nil},
+	{NAU7802_OCAL2_B2, "OCAL2_B2", nil},
+	{NAU7802_OCAL2_B1, "OCAL2_B1", nil},
+	{NAU7802_OCAL2_B0, "OCAL2_B0", nil},
+	{NAU7802_GCAL2_B3, "GCAL2_B3", nil},
+	{NAU7802_GCAL2_B2, "GCAL2_B2", nil},
+	{NAU7802_GCAL2_B1, "GCAL2_B1", nil},
+	{NAU7802_GCAL2_B0, "GCAL2_B0", nil},
+	{NAU7802_I2C_CONTROL, "I2C_CONTROL", []Field{
+		bit("BGPCP", NAU7802_I2C_CONTROL_BGPCP),
+		bit("TS", NAU7802_I2C_CONTROL_TS),
+		bit("BOPGA", NAU7802_I2C_CONTROL_BOPGA),
+		bit("SI", NAU7802_I2C_CONTROL_SI),
+		bit("WPD", NAU7802_I2C_CONTROL_WPD),
+		bit("SPE", NAU7802_I2C_CONTROL_SPE),
+		bit("FRD", NAU7802_I2C_CONTROL_FRD),
+		bit("CRSD", NAU7802_I2C_CONTROL_CRSD),
+	}},
+	{NAU7802_ADCO_B2, "ADCO_B2", nil},
+	{NAU7802_ADCO_B1, "ADCO_B1", nil},
+	{NAU7802_ADCO_B0, "ADCO_B0", nil},
+	{NAU7802_ADC, "ADC", []Field{
+		{Name: "REG_CHPS", Bit: NAU7802_ADC_REG_CHPS, Width: 2},
+		{Name: "ADC_VCM", Bit: NAU7802_ADC_ADC_VCM, Width: 2},
+		{Name: "REG_CHP", Bit: NAU7802_ADC_REG_CHP, Width: 2},
+	}},
+	{NAU7802_OTP_B1, "OTP_B1", nil},
+	{NAU7802_OTP_B0, "OTP_B0", nil},
+	{NAU7802_PGA, "PGA", []Field{
+		bit("CHP_DIS", NAU7802_PGA_CHP_DIS),
+		bit("INV", NAU7802_PGA_INV),
+		bit("BYPASS_EN", NAU7802_PGA_BYPASS_EN),
+		bit("OUT_EN", NAU7802_PGA_OUT_EN),
+		bit("LDOMODE", NAU7802_PGA_LDOMODE),
+		bit("RD_OTP_SEL", NAU7802_PGA_RD_OTP_SEL),
+	}},
+	{NAU7802_PGA_PWR, "PGA_PWR", []Field{
+		{Name: "PGA_CURR", Bit: NAU7802_PGA_PWR_PGA_CURR, Width: 2},
+		{Name: "ADC_CURR", Bit: NAU7802_PGA_PWR_ADC_CURR, Width: 2},
+		{Name: "MSTR_BIAS_CURR", Bit: NAU7802_PGA_PWR_MSTR_BIAS_CURR, Width: 3},
+		bit("PGA_CAP_EN", NAU7802_PGA_PWR_PGA_CAP_EN),
+	}},
+	{NAU7802_DEVICE_REV, "DEVICE_REV", []Field{
+		{Name: "REVISION_ID", Bit: 0, Width: 4},
+	}},
+}
+
+// DumpRegisters reads every register of the register map. Reading ADCO
+// consumes the pending conversion.
+func (n *NAU7802) DumpRegisters() ([]RegisterValue, error) {
+	regs := make(map[byte]byte)
+
+	// the map has gaps at the reserved registers, the rest is read in
+	// blocks
+	for _, block := range [][2]byte{
+		{NAU7802_PU_CTRL, NAU7802_OTP_B0},
+		{NAU7802_PGA, NAU7802_PGA_PWR},
+		{NAU7802_DEVICE_REV, NAU7802_DEVICE_REV},
+	} {
+		values, err := n.readBlock(block[0], block[1])
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			regs[block[0]+byte(i)] = v
+		}
+	}
+
+	dump := make([]RegisterValue, len(Registers))
+	for i, info := range Registers {
+		dump[i] = RegisterValue{RegisterInfo: info, Value: regs[info.Address]}
+	}
+
+	return dump, nil
+}
+
+// ReadOTP reads the three OTP bytes, which share their addresses with ADC,
+// OTP_B1 and OTP_B0 while RD_OTP_SEL is set. The PGA register is restored
+// afterwards.
+func (n *NAU7802) ReadOTP() ([]byte, error) {
+	pga, err := n.register(NAU7802_PGA)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = n.SetRegister(NAU7802_PGA, []byte{pga | 1<<NAU7802_PGA_RD_OTP_SEL}); err != nil {
+		return nil, err
+	}
+
+	otp, err := n.readBlock(NAU7802_ADC, NAU7802_OTP_B0)
+
+	if rerr := n.SetRegister(NAU7802_PGA, []byte{pga}); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return otp, nil
+}
+
+// Diagnose reads the registers and reports settings that are inconsistent
+// or keep the chip from converting. No problems are reported as an empty
+// list.
+func (n *NAU7802) Diagnose() ([]string, error) {
+	dump, err := n.DumpRegisters()
+	if err != nil {
+		return nil, err
+	}
+
+	regs := make(map[byte]byte)
+	for _, r := range dump {
+		regs[r.Address] = r.Value
+	}
+	set := func(reg byte, b uint) bool {
+		return regs[reg]&(1<<b) != 0
+	}
+
+	var problems []string
+	report := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if regs[NAU7802_DEVICE_REV]&0x0F != 0x0F {
+		report("DEVICE_REV is 0x%02X, the revision id 0xF was expected", regs[NAU7802_DEVICE_REV])
+	}
+
+	pud, pua := set(NAU7802_PU_CTRL, NAU7802_PU_CTRL_PUD), set(NAU7802_PU_CTRL, NAU7802_PU_CTRL_PUA)
+	switch {
+	case !pud && !pua:
+		report("PUD and PUA are cleared, the chip is powered down")
+	case pud != pua:
+		report("only one of PUD (%t) and PUA (%t) is set", pud, pua)
+	case !set(NAU7802_PU_CTRL, NAU7802_PU_CTRL_PUR):
+		report("PUD and PUA are set but PUR is not, the chip did not power up")
+	}
+	if set(NAU7802_PU_CTRL, NAU7802_PU_CTRL_RR) {
+		report("RR is set, the registers are held in reset")
+	}
+
+	ldo := ldoField.Value(regs[NAU7802_CTRL1])
+	avdds := set(NAU7802_PU_CTRL, NAU7802_PU_CTRL_AVDDS)
+	switch {
+	case avdds && ldo == NAU7802_LDO_4V5:
+		report("AVDDS selects the internal LDO but VLDO is still at its reset value %s", describeLDO(ldo))
+	case !avdds && ldo != NAU7802_LDO_4V5:
+		report("VLDO is set to %s but AVDDS is cleared, the LDO is not used", describeLDO(ldo))
+	}
+
+	if rate := rateField.Value(regs[NAU7802_CTRL2]); SamplesPerSecond(int(rate)) == 0 {
+		report("CRS selects the reserved sample rate code %d", rate)
+	}
+	if set(NAU7802_CTRL2, NAU7802_CTRL2_CALS) {
+		report("CALS is set, a calibration is in progress")
+	}
+	if set(NAU7802_CTRL2, NAU7802_CTRL2_CAL_ERROR) {
+		report("CAL_ERROR is set, the last calibration failed")
+	}
+
+	for ch, reg := range []byte{NAU7802_GCAL1_B3, NAU7802_GCAL2_B3} {
+		if regs[reg]|regs[reg+1]|regs[reg+2]|regs[reg+3] == 0 {
+			report("GCAL of channel %d is zero, every conversion reads zero", ch+1)
+		}
+	}
+
+	if set(NAU7802_PGA_PWR, NAU7802_PGA_PWR_PGA_CAP_EN) && set(NAU7802_CTRL2, NAU7802_CTRL2_CHS) {
+		report("PGA_CAP_EN is set while channel 2 is selected, the capacitor sits on its inputs")
+	}
+	if set(NAU7802_I2C_CONTROL, NAU7802_I2C_CONTROL_TS) {
+		report("TS is set, the ADC converts the temperature sensor instead of the bridge")
+	}
+	if set(NAU7802_PGA, NAU7802_PGA_RD_OTP_SEL) {
+		report("RD_OTP_SEL is set, the ADC register reads OTP")
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,137 @@
+package device_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/sim"
+)
+
+// revision is a simulated chip with another DEVICE_REV.
+type revision struct {
+	*sim.NAU7802
+	rev byte
+}
+
+func (r *revision) ReadReg(reg byte, buf []byte) error {
+	if err := r.NAU7802.ReadReg(reg, buf); err != nil {
+		return err
+	}
+	if i := int(device.NAU7802_DEVICE_REV) - int(reg); i >= 0 && i < len(buf) {
+		buf[i] = r.rev
+	}
+	return nil
+}
+
+func TestDiagnose(t *testing.T) {
+	tests := []struct {
+		name    string
+		bus     func(chip *sim.NAU7802) device.Bus
+		change  func(chip *sim.NAU7802, nau7802 *device.NAU7802) error
+		problem string // "" for a clean chip
+	}{
+		{"clean", nil, nil, ""},
+		{"PUA cleared", nil, func(chip *sim.NAU7802, nau7802 *device.NAU7802) error {
+			return nau7802.SetBit(device.NAU7802_PU_CTRL_PUA, device.NAU7802_PU_CTRL, false)
+		}, "only one of PUD (true) and PUA (false) is set"},
+		{"powered down", nil, func(chip *sim.NAU7802, nau7802 *device.NAU7802) error {
+			return nau7802.PowerDown()
+		}, "the chip is powered down"},
+		{"wrong revision", func(chip *sim.NAU7802) device.Bus {
+			return &revision{NAU7802: chip, rev: 0x0E}
+		}, nil, "DEVICE_REV is 0x0E"},
+		{"zero GCAL", nil, func(chip *sim.NAU7802, nau7802 *device.NAU7802) error {
+			return nau7802.WriteAFECalibration(device.NAU7802_CHANNEL_2, device.AFECalibration{})
+		}, "GCAL of channel 2 is zero"},
+		{"failed calibration", nil, func(chip *sim.NAU7802, nau7802 *device.NAU7802) error {
+			chip.CalibrationError = true
+			nau7802.CalibrateAFE()
+			return nil
+		}, "CAL_ERROR is set"},
+		{"temperature sensor", nil, func(chip *sim.NAU7802, nau7802 *device.NAU7802) error {
+			return nau7802.SetBit(device.NAU7802_I2C_CONTROL_TS, device.NAU7802_I2C_CONTROL, true)
+		}, "TS is set"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chip := sim.New()
+			var bus device.Bus = chip
+			if tt.bus != nil {
+				bus = tt.bus(chip)
+			}
+			nau7802 := device.New(bus)
+			if err := nau7802.Initialize(); err != nil {
+				t.Fatal(err)
+			}
+			if tt.change != nil {
+				if err := tt.change(chip, nau7802); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			problems, err := nau7802.Diagnose()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.problem == "" {
+				if len(problems) != 0 {
+					t.Errorf("problems on a correctly configured chip: %q", problems)
+				}
+				return
+			}
+			found := false
+			for _, p := range problems {
+				found = found || strings.Contains(p, tt.problem)
+			}
+			if !found {
+				t.Errorf("got %q, want %q", problems, tt.problem)
+			}
+		})
+	}
+}
+
+func TestDumpRegisters(t *testing.T) {
+	chip, nau7802 := initialized(t, nil)
+
+	dump, err := nau7802.DumpRegisters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dump) != len(device.Registers) {
+		t.Fatalf("%d registers, want %d", len(dump), len(device.Registers))
+	}
+	for _, r := range dump {
+		if r.Address == device.NAU7802_ADCO_B2 || r.Address == device.NAU7802_ADCO_B1 || r.Address == device.NAU7802_ADCO_B0 {
+			continue
+		}
+		if want := chip.Register(r.Address); r.Value != want {
+			t.Errorf("%s is %#02x, want %#02x", r.Name, r.Value, want)
+		}
+	}
+
+	last := dump[len(dump)-1]
+	if last.Name != "DEVICE_REV" || last.Decode() != "REVISION_ID=15" {
+		t.Errorf("%s decodes as %q, want REVISION_ID=15", last.Name, last.Decode())
+	}
+}
+
+func TestReadOTP(t *testing.T) {
+	chip, nau7802 := initialized(t, func(chip *sim.NAU7802) {
+		chip.OTP = [3]byte{0x12, 0x34, 0x56}
+	})
+	pga := chip.Register(device.NAU7802_PGA)
+
+	otp, err := nau7802.ReadOTP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(otp, []byte{0x12, 0x34, 0x56}) {
+		t.Errorf("OTP % x, want 12 34 56", otp)
+	}
+	if got := chip.Register(device.NAU7802_PGA); got != pga {
+		t.Errorf("PGA %#02x after reading the OTP, want %#02x", got, pga)
+	}
+}
@@ -0,0 +1,43 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotConnected       = errors.New("nau7802: device not connected")
+	ErrInvalidGain        = errors.New("nau7802: invalid gain value")
+	ErrInvalidLDO         = errors.New("nau7802: invalid ldo value")
+	ErrInvalidSampleRate  = errors.New("nau7802: invalid sample rate value")
+	ErrInvalidChannel     = errors.New("nau7802: invalid channel")
+	ErrNegativeWeight     = errors.New("nau7802: negative weight not allowed")
+	ErrCalibration        = errors.New("nau7802: calibration error")
+	ErrTimeout            = errors.New("nau7802: timeout")
+	ErrPowerUp            = errors.New("nau7802: power up failed")
+	ErrPowerDown          = errors.New("nau7802: power down failed")
+	ErrInvalidSampleCount = errors.New("nau7802: sample count must be positive")
+
+	ErrInvalidCalibrationMode = errors.New("nau7802: invalid calibration mode")
+	ErrInvalidOffset          = errors.New("nau7802: offset out of 24-bit range")
+
+	// The ADC output is saturated, the input is above or below the range
+	// of the converter at the configured gain.
+	ErrOverRange  = errors.New("nau7802: adc over range")
+	ErrUnderRange = errors.New("nau7802: adc under range")
+)
+
+// RegisterError is returned when a register could not be read or written.
+type RegisterError struct {
+	Op       string
+	Register byte
+	Err      error
+}
+
+func (e *RegisterError) Error() string {
+	return fmt.Sprintf("nau7802: %s register 0x%02X: %v", e.Op, e.Register, e.Err)
+}
+
+func (e *RegisterError) Unwrap() error {
+	return e.Err
+}
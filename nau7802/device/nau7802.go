@@ -0,0 +1,460 @@
+package device
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/SimonWaldherr/rpi-examples/calibration"
+	"golang.org/x/exp/io/i2c"
+)
+
+type NAU7802 struct {
+	Dev        Bus
+	cal        [2]Calibration
+	channel    int
+	settle     int
+	discard    int
+	sampleRate int
+	timeouts   Timeouts
+	power      PowerState
+	shadow     shadow
+	stats      BusStats
+
+	temperature  float64
+	tempAt       time.Time
+	tempInterval time.Duration
+	tempOffset   float64
+}
+
+// New returns a driver talking to the NAU7802 through bus. It is used with
+// the simulator in nau7802/sim or any other Bus implementation.
+func New(bus Bus) *NAU7802 {
+	return &NAU7802{
+		Dev:      bus,
+		cal:      [2]Calibration{{CalibrationFactor: 1.0}, {CalibrationFactor: 1.0}},
+		settle:   1,
+		timeouts: DefaultTimeouts(),
+	}
+}
+
+// NewNAU7802 opens the NAU7802 at addr on the given I2C bus, e.g. DEFAULT_BUS
+// and DEVICE_ADDRESS.
+func NewNAU7802(bus string, addr int) (*NAU7802, error) {
+	dev, err := i2c.Open(&i2c.Devfs{Dev: bus}, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(dev), nil
+}
+
+// Close closes the underlying bus if it supports closing.
+func (n *NAU7802) Close() error {
+	if c, ok := n.Dev.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (n *NAU7802) IsConnected() bool {
+	data := make([]byte, 1)
+	err := n.busRead(NAU7802_DEVICE_REV, data)
+	if err != nil {
+		return false // Sensor did not ACK
+	}
+	return true // All good
+}
+
+// GetBit reads one bit of a register. Configuration bits come from the
+// shadow copy, status bits are read from the chip.
+func (n *NAU7802) GetBit(bit, register byte) (bool, error) {
+	if int(register) >= registerCount || volatile[register]&(1<<bit) != 0 {
+		buf, err := n.GetRegister(register)
+		if err != nil {
+			return false, err
+		}
+		return (buf[0]>>bit)&1 == 1, nil
+	}
+
+	val, err := n.register(register)
+	if err != nil {
+		return false, err
+	}
+
+	return (val>>bit)&1 == 1, nil
+}
+
+// SetBit changes one bit of a register, it does not touch the bus if the
+// shadow copy shows the bit already has the value.
+func (n *NAU7802) SetBit(bit, register byte, value bool) error {
+	var data byte
+	if value {
+		data = 1 << bit
+	}
+
+	return n.update(register, 1<<bit, data)
+}
+
+// GetRegister reads a register from the chip, bypassing the shadow copy.
+func (n *NAU7802) GetRegister(register byte) ([]byte, error) {
+	buf := make([]byte, 1)
+
+	err := n.busRead(register, buf)
+	if err != nil {
+		return []byte{}, &RegisterError{Op: "read", Register: register, Err: err}
+	}
+
+	return buf, nil
+}
+
+// SetRegister writes value to the register, more than one byte go to the
+// following registers.
+func (n *NAU7802) SetRegister(register byte, value []byte) error {
+	if err := n.busWrite(register, value); err != nil {
+		return &RegisterError{Op: "write", Register: register, Err: err}
+	}
+	return nil
+}
+
+// Available reports whether a new conversion is ready to be read.
+func (n *NAU7802) Available() bool {
+	val, err := n.GetBit(NAU7802_PU_CTRL_CR, NAU7802_PU_CTRL)
+	if err != nil {
+		return false
+	}
+	return val
+}
+
+// WaitAvailable polls the CR bit until a new conversion is ready. It returns
+// ErrTimeout if none arrived within timeout.
+func (n *NAU7802) WaitAvailable(timeout time.Duration) error {
+	poll := ConversionTime(n.sampleRate) / 10
+	start := time.Now()
+
+	for {
+		ready, err := n.GetBit(NAU7802_PU_CTRL_CR, NAU7802_PU_CTRL)
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+
+		if time.Since(start) > timeout {
+			return ErrTimeout
+		}
+
+		time.Sleep(poll)
+	}
+}
+
+// ReadingTimeout is how long GetNextReading waits for a conversion at the
+// configured sample rate.
+func (n *NAU7802) ReadingTimeout() time.Duration {
+	return 3*ConversionTime(n.sampleRate) + 10*time.Millisecond
+}
+
+// GetNextReading waits for a fresh conversion and returns it, reading the
+// result clears CR so every call returns a different conversion. After a
+// channel switch the settling conversions are discarded first.
+func (n *NAU7802) GetNextReading() (int32, error) {
+	for ; n.discard > 0; n.discard-- {
+		if err := n.WaitAvailable(n.ReadingTimeout()); err != nil {
+			return 0, err
+		}
+		if _, err := n.GetReading(); errors.As(err, new(*RegisterError)) {
+			return 0, err
+		}
+	}
+
+	if err := n.WaitAvailable(n.ReadingTimeout()); err != nil {
+		return 0, err
+	}
+
+	return n.GetReading()
+}
+
+// GetReading returns the last conversion as signed value. If the ADC is
+// saturated the clipped value is returned together with ErrOverRange or
+// ErrUnderRange.
+func (n *NAU7802) GetReading() (int32, error) {
+	data := make([]byte, 3)
+
+	err := n.busRead(NAU7802_ADCO_B2, data)
+	if err != nil {
+		return 0, &RegisterError{Op: "read", Register: NAU7802_ADCO_B2, Err: err} // Sensor did not ACK
+	}
+
+	value := decodeReading(data)
+
+	switch value {
+	case NAU7802_ADC_MAX:
+		return value, ErrOverRange
+	case NAU7802_ADC_MIN:
+		return value, ErrUnderRange
+	}
+
+	return value, nil
+}
+
+// decodeReading converts the three big-endian ADCO bytes from two's
+// complement 24-bit to int32.
+func decodeReading(data []byte) int32 {
+	return int32(uint32(data[0])<<24|uint32(data[1])<<16|uint32(data[2])<<8) >> 8
+}
+
+// GetAverage returns the mean of the next average conversions.
+func (n *NAU7802) GetAverage(average int) (int32, error) {
+	if average < 1 {
+		return 0, ErrInvalidSampleCount
+	}
+
+	var sum int64
+	for i := 0; i < average; i++ {
+		data, err := n.GetNextReading()
+		if err != nil {
+			return 0, err
+		}
+
+		sum += int64(data)
+	}
+
+	return int32(sum / int64(average)), nil
+}
+
+func (n *NAU7802) CalculateZeroOffset(average int) error {
+	data, err := n.GetAverage(average)
+	if err != nil {
+		return err
+	}
+
+	n.cal[n.channel].ZeroOffset = n.compensate(data)
+
+	return nil
+}
+
+// SetZeroOffset sets the zero offset of the selected channel.
+func (n *NAU7802) SetZeroOffset(offset int32) {
+	n.cal[n.channel].ZeroOffset = offset
+}
+
+func (n *NAU7802) GetZeroOffset() int32 {
+	return n.cal[n.channel].ZeroOffset
+}
+
+func (n *NAU7802) CalculateCalibrationFactor(knownWeight float64, average int) error {
+	data, err := n.GetAverage(average)
+	if err != nil {
+		return err
+	}
+
+	n.cal[n.channel].CalibrationFactor = float64(n.compensate(data)-n.cal[n.channel].ZeroOffset) / knownWeight
+
+	return nil
+}
+
+// SetCalibrationFactor sets the calibration factor of the selected channel.
+func (n *NAU7802) SetCalibrationFactor(factor float64) {
+	n.cal[n.channel].CalibrationFactor = factor
+}
+
+func (n *NAU7802) GetCalibrationFactor() float64 {
+	return n.cal[n.channel].CalibrationFactor
+}
+
+func (n *NAU7802) GetWeight(allowNegative bool, samples int) (float64, error) {
+	data, err := n.GetAverage(samples)
+	if err != nil {
+		return 0, err
+	}
+
+	if !allowNegative && n.compensate(data) < n.cal[n.channel].ZeroOffset {
+		return 0, ErrNegativeWeight
+	}
+
+	return n.toWeight(data), nil
+}
+
+// SetCurve sets a calibration curve for the selected channel which
+// replaces the linear calibration factor, nil goes back to the factor.
+func (n *NAU7802) SetCurve(curve *calibration.Curve) {
+	n.cal[n.channel].Curve = curve
+}
+
+func (n *NAU7802) GetCurve() *calibration.Curve {
+	return n.cal[n.channel].Curve
+}
+
+// toWeight converts a raw reading with the calibration of the selected
+// channel.
+func (n *NAU7802) toWeight(raw int32) float64 {
+	return n.cal[n.channel].Weight(n.compensate(raw))
+}
+
+func (n *NAU7802) SetGain(gain int) error {
+	if gain < 0 || gain > 7 {
+		return ErrInvalidGain
+	}
+
+	return n.update(NAU7802_CTRL1, 0b00000111, uint8(gain))
+}
+
+func (n *NAU7802) SetLDO(ldo int) error {
+	if ldo < 0 || ldo > 7 {
+		return ErrInvalidLDO
+	}
+
+	if err := n.update(NAU7802_CTRL1, 0b00111000, uint8(ldo<<3)); err != nil {
+		return err
+	}
+
+	return n.SetBit(NAU7802_PU_CTRL_AVDDS, NAU7802_PU_CTRL, true)
+}
+
+func (n *NAU7802) SetSampleRate(rate int) error {
+	if ConversionTime(rate) == 0 {
+		return ErrInvalidSampleRate
+	}
+
+	if err := n.update(NAU7802_CTRL2, 0b01110000, uint8(rate<<4)); err != nil {
+		return err
+	}
+
+	n.sampleRate = rate
+
+	return nil
+}
+
+func (n *NAU7802) GetSampleRate() int {
+	return n.sampleRate
+}
+
+// SetChannel selects the input channel. The conversions needed to settle
+// after a switch are discarded by the following GetNextReading.
+func (n *NAU7802) SetChannel(channel int) error {
+	if channel != NAU7802_CHANNEL_1 && channel != NAU7802_CHANNEL_2 {
+		return ErrInvalidChannel
+	}
+
+	if err := n.SetBit(NAU7802_CTRL2_CHS, NAU7802_CTRL2, channel == NAU7802_CHANNEL_2); err != nil {
+		return err
+	}
+
+	if channel != n.channel {
+		n.discard = n.settle
+	}
+	n.channel = channel
+
+	return nil
+}
+
+func (n *NAU7802) GetChannel() int {
+	return n.channel
+}
+
+func (n *NAU7802) Reset() error {
+	if err := n.SetBit(NAU7802_PU_CTRL_RR, NAU7802_PU_CTRL, true); err != nil {
+		return err
+	}
+	time.Sleep(1 * time.Millisecond)
+
+	// all registers are back at their defaults
+	n.sampleRate = NAU7802_SPS_10
+	n.channel = NAU7802_CHANNEL_1
+	n.power = PowerOff
+
+	return n.SetBit(NAU7802_PU_CTRL_RR, NAU7802_PU_CTRL, false)
+}
+
+func (n *NAU7802) SetIntPolarityHigh() error {
+	return n.SetBit(NAU7802_CTRL1_CRP, NAU7802_CTRL1, false)
+}
+
+func (n *NAU7802) SetIntPolarityLow() error {
+	return n.SetBit(NAU7802_CTRL1_CRP, NAU7802_CTRL1, true)
+}
+
+func (n *NAU7802) GetRevisionCode() ([]byte, error) {
+	return n.GetRegister(NAU7802_DEVICE_REV)
+}
+
+// Initialize resets the chip, powers it up and configures it with the
+// settings of DefaultProfile: a load cell on channel 1 with 3.3V LDO, gain
+// 128 and 80 samples per second.
+func (n *NAU7802) Initialize() error {
+	return n.InitializeProfile(DefaultProfile())
+}
+
+// InitializeProfile resets the chip, powers it up and applies the chip
+// settings, zero offset and calibration factor of p.
+func (n *NAU7802) InitializeProfile(p Profile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	// Validate made sure the conversion succeeds
+	channel, _ := ChannelCode(p.Channel)
+
+	if !n.IsConnected() {
+		return ErrNotConnected
+	}
+
+	if err := n.Reset(); err != nil {
+		return err
+	}
+
+	if err := n.PowerUp(); err != nil {
+		return err
+	}
+
+	config := p.Config()
+	if err := n.Configure(config); err != nil {
+		return err
+	}
+
+	// give the LDO and the analog front-end time to settle
+	time.Sleep(200 * time.Millisecond)
+
+	if err := n.VerifyConfig(config); err != nil {
+		return err
+	}
+
+	if err := n.initializeAFE(p, channel); err != nil {
+		return err
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	p.Apply(n)
+
+	return nil
+}
+
+// initializeAFE restores the stored calibration registers of the profile's
+// channels and runs the internal calibration for channels without. channel
+// is selected on return.
+func (n *NAU7802) initializeAFE(p Profile, channel int) error {
+	cals := map[int]*Calibration{channel: &p.Calibration}
+	if p.Dual() {
+		cals[1-channel] = p.SecondChannel
+	}
+
+	for ch, cal := range cals {
+		if cal.AFE != nil {
+			if err := n.WriteAFECalibration(ch, *cal.AFE); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := n.SetChannel(ch); err != nil {
+			return err
+		}
+		if err := n.CalibrateAFE(); err != nil {
+			return err
+		}
+	}
+
+	return n.SetChannel(channel)
+}
@@ -0,0 +1,111 @@
+package device_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/sim"
+)
+
+// initialized returns a simulated chip and the driver initialized on it
+// with the default profile.
+func initialized(t *testing.T, setup func(chip *sim.NAU7802)) (*sim.NAU7802, *device.NAU7802) {
+	t.Helper()
+
+	chip := sim.New()
+	if setup != nil {
+		setup(chip)
+	}
+	nau7802 := device.New(chip)
+	if err := nau7802.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	return chip, nau7802
+}
+
+func TestInitialize(t *testing.T) {
+	chip, nau7802 := initialized(t, nil)
+
+	if state := nau7802.GetPowerState(); state != device.PowerOn {
+		t.Errorf("power state %v, want on", state)
+	}
+	if chip.Register(device.NAU7802_PU_CTRL)&(1<<device.NAU7802_PU_CTRL_PUR) == 0 {
+		t.Error("PUR not set")
+	}
+	if gain := chip.Register(device.NAU7802_CTRL1) & 0b111; gain != device.NAU7802_GAIN_128 {
+		t.Errorf("gain code %d, want %d", gain, device.NAU7802_GAIN_128)
+	}
+	if rate := chip.Register(device.NAU7802_CTRL2) >> device.NAU7802_CTRL2_CRS & 0b111; rate != device.NAU7802_SPS_80 {
+		t.Errorf("rate code %d, want %d", rate, device.NAU7802_SPS_80)
+	}
+	if chip.Register(device.NAU7802_CTRL2)&(1<<device.NAU7802_CTRL2_CHS) != 0 {
+		t.Error("channel 2 selected, want channel 1")
+	}
+	if offset := nau7802.GetZeroOffset(); offset != device.DefaultProfile().ZeroOffset {
+		t.Errorf("zero offset %d, want %d", offset, device.DefaultProfile().ZeroOffset)
+	}
+}
+
+func TestGetWeight(t *testing.T) {
+	tests := []struct {
+		name          string
+		raw           int32
+		allowNegative bool
+		want          float64
+		err           error
+	}{
+		{"zero", 1000, false, 0, nil},
+		{"load", 6000, false, 100, nil},
+		{"negative allowed", 500, true, -10, nil},
+		{"negative", 500, false, 0, device.ErrNegativeWeight},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, nau7802 := initialized(t, func(chip *sim.NAU7802) {
+				chip.SetRaw(device.NAU7802_CHANNEL_1, tt.raw)
+			})
+			nau7802.SetZeroOffset(1000)
+			nau7802.SetCalibrationFactor(50)
+
+			weight, err := nau7802.GetWeight(tt.allowNegative, 4)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if math.Abs(weight-tt.want) > 1e-9 {
+				t.Errorf("weight %v, want %v", weight, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetNextReading(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  int32
+		want int32
+		err  error
+	}{
+		{"positive", 1000, 1000, nil},
+		{"negative", -1000, -1000, nil},
+		{"over range", 1 << 24, 0, device.ErrOverRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, nau7802 := initialized(t, func(chip *sim.NAU7802) {
+				chip.SetRaw(device.NAU7802_CHANNEL_1, tt.raw)
+			})
+
+			raw, err := nau7802.GetNextReading()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err == nil && raw != tt.want {
+				t.Errorf("got %d, want %d", raw, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package device
+
+import (
+	"errors"
+	"time"
+)
+
+// Timeouts limit how long the driver waits for the chip to change state.
+type Timeouts struct {
+	PowerUp   time.Duration
+	PowerDown time.Duration
+	// Calibration of zero waits for ten conversions at the configured
+	// sample rate, but at least 100ms.
+	Calibration time.Duration
+}
+
+// DefaultTimeouts are used by New.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		PowerUp:   100 * time.Millisecond,
+		PowerDown: 100 * time.Millisecond,
+	}
+}
+
+func (n *NAU7802) SetTimeouts(t Timeouts) {
+	n.timeouts = t
+}
+
+func (n *NAU7802) GetTimeouts() Timeouts {
+	return n.timeouts
+}
+
+// PowerState is the state of the power transitions of the driver.
+type PowerState int
+
+const (
+	// PowerOff: PUD and PUA are cleared and PUR is not set.
+	PowerOff PowerState = iota
+	// PowerStarting: PUD and PUA are set, PUR is not set yet.
+	PowerStarting
+	// PowerOn: PUR is set, the chip is converting.
+	PowerOn
+	// PowerStopping: PUD and PUA are cleared, PUR is still set.
+	PowerStopping
+)
+
+func (s PowerState) String() string {
+	switch s {
+	case PowerOff:
+		return "off"
+	case PowerStarting:
+		return "starting"
+	case PowerOn:
+		return "on"
+	case PowerStopping:
+		return "stopping"
+	}
+	return "unknown"
+}
+
+// GetPowerState returns the state the last power transition left the chip
+// in.
+func (n *NAU7802) GetPowerState() PowerState {
+	return n.power
+}
+
+// PowerUp powers the digital and analog parts and waits for PUR. If PUR is
+// not reported within the power-up timeout ErrPowerUp is returned and the
+// state stays PowerStarting.
+func (n *NAU7802) PowerUp() error {
+	return n.powerTransition(true)
+}
+
+// PowerDown powers down both parts and waits for PUR to clear. If it stays
+// set for the power-down timeout ErrPowerDown is returned and the state
+// stays PowerStopping.
+func (n *NAU7802) PowerDown() error {
+	return n.powerTransition(false)
+}
+
+func (n *NAU7802) powerTransition(up bool) error {
+	state := PowerStopping
+	timeout := n.timeouts.PowerDown
+	failed := ErrPowerDown
+	if up {
+		state = PowerStarting
+		timeout = n.timeouts.PowerUp
+		failed = ErrPowerUp
+	}
+
+	for {
+		switch state {
+		case PowerStarting, PowerStopping:
+			mask := byte(1<<NAU7802_PU_CTRL_PUD | 1<<NAU7802_PU_CTRL_PUA)
+			var val byte
+			if up {
+				val = mask
+			}
+			if err := n.update(NAU7802_PU_CTRL, mask, val); err != nil {
+				return err
+			}
+			n.power = state
+
+			err := poll(timeout, func() (bool, error) {
+				ready, err := n.GetBit(NAU7802_PU_CTRL_PUR, NAU7802_PU_CTRL)
+				return ready == up, err
+			})
+			if errors.Is(err, ErrTimeout) {
+				return failed
+			}
+			if err != nil {
+				return err
+			}
+
+			if up {
+				state = PowerOn
+			} else {
+				state = PowerOff
+			}
+		case PowerOn, PowerOff:
+			n.power = state
+			return nil
+		}
+	}
+}
+
+// poll calls done every millisecond until it reports true or an error. It
+// returns ErrTimeout if done did not succeed within timeout, but always
+// calls it at least once.
+func poll(timeout time.Duration, done func() (bool, error)) error {
+	start := time.Now()
+
+	for {
+		ok, err := done()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		if time.Since(start) > timeout {
+			return ErrTimeout
+		}
+
+		time.Sleep(1 * time.Millisecond)
+	}
+}
@@ -0,0 +1,53 @@
+package device_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/sim"
+)
+
+func TestPowerUpTimeout(t *testing.T) {
+	chip := sim.New()
+	chip.StuckPowerUp = true
+	nau7802 := device.New(chip)
+
+	if err := nau7802.Initialize(); !errors.Is(err, device.ErrPowerUp) {
+		t.Fatalf("got error %v, want %v", err, device.ErrPowerUp)
+	}
+	if state := nau7802.GetPowerState(); state != device.PowerStarting {
+		t.Errorf("power state %v, want starting", state)
+	}
+}
+
+func TestPowerDown(t *testing.T) {
+	tests := []struct {
+		name  string
+		stuck bool
+		err   error
+		state device.PowerState
+		pur   bool
+	}{
+		{"power down", false, nil, device.PowerOff, false},
+		{"timeout", true, device.ErrPowerDown, device.PowerStopping, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chip, nau7802 := initialized(t, func(chip *sim.NAU7802) {
+				chip.StuckPowerDown = tt.stuck
+			})
+
+			if err := nau7802.PowerDown(); !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if state := nau7802.GetPowerState(); state != tt.state {
+				t.Errorf("power state %v, want %v", state, tt.state)
+			}
+			if pur := chip.Register(device.NAU7802_PU_CTRL)&(1<<device.NAU7802_PU_CTRL_PUR) != 0; pur != tt.pur {
+				t.Errorf("PUR %v, want %v", pur, tt.pur)
+			}
+		})
+	}
+}
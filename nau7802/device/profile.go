@@ -0,0 +1,213 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/SimonWaldherr/rpi-examples/jsonfile"
+)
+
+// Profile is the calibration and configuration of one physical scale. It is
+// stored as JSON, gain, sample rate, channel and LDO voltage are given in
+// their natural units rather than as register codes.
+type Profile struct {
+	// Calibration of Channel
+	Calibration
+
+	Gain       int     `json:"gain"`
+	SampleRate int     `json:"sample_rate"`
+	Channel    int     `json:"channel"`
+	LDO        float64 `json:"ldo"`
+
+	// SecondChannel is the calibration of the other channel. If it is set
+	// both channels are read alternately.
+	SecondChannel *Calibration `json:"second_channel,omitempty"`
+
+	// TemperatureInterval is the time in seconds between readings of the
+	// temperature sensor while streaming, 0 turns them off.
+	// TemperatureOffset corrects the sensor in °C.
+	TemperatureInterval float64 `json:"temperature_interval,omitempty"`
+	TemperatureOffset   float64 `json:"temperature_offset,omitempty"`
+
+	// Options of the analog front-end, see Config.
+	Options *Options `json:"options,omitempty"`
+
+	// Filter is the filter chain used by the scale package, the driver
+	// does not filter.
+	Filter string `json:"filter,omitempty"`
+}
+
+// DefaultProfile returns the settings the example load cell was
+// calibrated with. It sits on channel 1: the original example selected
+// channel 2 before resetting the chip, so the reset put it back on
+// channel 1, where the zero offset and factor below were measured.
+func DefaultProfile() Profile {
+	return Profile{
+		Calibration: Calibration{
+			ZeroOffset:        -22872,
+			CalibrationFactor: 153.52 / 2.5,
+		},
+		Gain:       128,
+		SampleRate: 80,
+		Channel:    1,
+		LDO:        3.3,
+	}
+}
+
+// LoadProfile reads a profile from a JSON file. Fields missing in the file
+// keep the values of DefaultProfile, those missing in the options section
+// the ones of DefaultOptions.
+func LoadProfile(path string) (Profile, error) {
+	p := DefaultProfile()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+
+	if err = json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("nau7802: profile %s: %v", path, err)
+	}
+
+	if p.Options != nil {
+		// the options missing in the section keep their defaults
+		options := DefaultOptions()
+		section := struct {
+			Options *Options `json:"options"`
+		}{&options}
+		if err = json.Unmarshal(data, &section); err != nil {
+			return p, fmt.Errorf("nau7802: profile %s: %v", path, err)
+		}
+		p.Options = &options
+	}
+
+	return p, p.Validate()
+}
+
+// Save writes the profile to path. The file is replaced atomically, so a
+// crash never leaves a half written profile behind.
+func (p Profile) Save(path string) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	return jsonfile.Save(path, p)
+}
+
+// Config returns the front-end configuration of the profile. Without
+// options DefaultOptions are used, but the PGA capacitor is only enabled if
+// channel 2 is not in use.
+func (p Profile) Config() Config {
+	c := Config{
+		Gain:       p.Gain,
+		SampleRate: p.SampleRate,
+		Channel:    p.Channel,
+		LDO:        p.LDO,
+		Options:    DefaultOptions(),
+	}
+
+	if p.Options != nil {
+		c.Options = *p.Options
+	} else {
+		c.PGACapacitor = p.Channel == 1 && !p.Dual()
+	}
+
+	return c
+}
+
+// Validate checks that all settings can be applied to the chip.
+func (p Profile) Validate() error {
+	c := p.Config()
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if c.PGACapacitor && p.Dual() {
+		return fmt.Errorf("nau7802: the PGA capacitor can not be enabled while channel 2 is used")
+	}
+	if p.TemperatureInterval < 0 || math.IsNaN(p.TemperatureInterval) {
+		return fmt.Errorf("nau7802: invalid temperature interval %v", p.TemperatureInterval)
+	}
+	if err := p.Calibration.Validate(); err != nil {
+		return err
+	}
+	if p.SecondChannel != nil {
+		return p.SecondChannel.Validate()
+	}
+	return nil
+}
+
+// Dual reports whether both channels are used.
+func (p Profile) Dual() bool {
+	return p.SecondChannel != nil
+}
+
+// ForChannel returns the calibration of channel 1 or 2 or nil if the
+// channel is not used.
+func (p *Profile) ForChannel(channel int) *Calibration {
+	if channel == p.Channel {
+		return &p.Calibration
+	}
+	if channel == 1 || channel == 2 {
+		return p.SecondChannel
+	}
+	return nil
+}
+
+// Apply sets the calibration of the profile's channels and the temperature
+// settings. The chip settings are applied by InitializeProfile.
+func (p Profile) Apply(n *NAU7802) {
+	channel, _ := ChannelCode(p.Channel)
+	n.SetChannelCalibration(channel, p.Calibration)
+
+	if p.SecondChannel != nil {
+		n.SetChannelCalibration(1-channel, *p.SecondChannel)
+	}
+
+	n.SetTemperatureInterval(time.Duration(p.TemperatureInterval * float64(time.Second)))
+	n.SetTemperatureOffset(p.TemperatureOffset)
+}
+
+// GainCode returns the NAU7802_GAIN_* value for a gain of 1 to 128.
+func GainCode(gain int) (int, error) {
+	for code := NAU7802_GAIN_1; code <= NAU7802_GAIN_128; code++ {
+		if 1<<uint(code) == gain {
+			return code, nil
+		}
+	}
+	return 0, ErrInvalidGain
+}
+
+// SampleRateCode returns the NAU7802_SPS_* value for 10, 20, 40, 80 or 320
+// samples per second.
+func SampleRateCode(sps int) (int, error) {
+	for code := NAU7802_SPS_10; code <= NAU7802_SPS_320; code++ {
+		if SamplesPerSecond(code) == sps {
+			return code, nil
+		}
+	}
+	return 0, ErrInvalidSampleRate
+}
+
+// ChannelCode returns the NAU7802_CHANNEL_* value for channel 1 or 2.
+func ChannelCode(channel int) (int, error) {
+	switch channel {
+	case 1:
+		return NAU7802_CHANNEL_1, nil
+	case 2:
+		return NAU7802_CHANNEL_2, nil
+	}
+	return 0, ErrInvalidChannel
+}
+
+// LDOCode returns the NAU7802_LDO_* value for 2.4 to 4.5 volts in steps of
+// 0.3 volts.
+func LDOCode(volts float64) (int, error) {
+	code := math.Round((4.5 - volts) / 0.3)
+	if code < NAU7802_LDO_4V5 || code > NAU7802_LDO_2V4 || math.Abs(4.5-code*0.3-volts) > 0.01 {
+		return 0, ErrInvalidLDO
+	}
+	return int(code), nil
+}
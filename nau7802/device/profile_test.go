@@ -0,0 +1,166 @@
+package device_test
+
+import (
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/sim"
+)
+
+func TestLoadProfileOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options string
+		want    func(o *device.Options)
+	}{
+		{"partial", `{"strong_pullup": true}`, func(o *device.Options) {
+			o.StrongPullUp = true
+		}},
+		{"empty", `{}`, func(o *device.Options) {}},
+		{"defaults overridden", `{"chopper_clock": 0, "pga_capacitor": false}`, func(o *device.Options) {
+			o.ChopperClock, o.PGACapacitor = 0, false
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "nau7802.json")
+			data := `{"gain": 64, "options": ` + tt.options + `}`
+			if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := device.LoadProfile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := device.DefaultOptions()
+			tt.want(&want)
+			if p.Options == nil || *p.Options != want {
+				t.Fatalf("got %+v, want %+v", p.Options, want)
+			}
+			if p.Gain != 64 {
+				t.Errorf("gain %d, want 64", p.Gain)
+			}
+
+			// a saved profile loads the same options
+			if err = p.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			if p, err = device.LoadProfile(path); err != nil {
+				t.Fatal(err)
+			}
+			if *p.Options != want {
+				t.Errorf("after saving got %+v, want %+v", *p.Options, want)
+			}
+		})
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(p *device.Profile)
+		err    error // nil for an error without a sentinel
+		valid  bool
+	}{
+		{"default", func(p *device.Profile) {}, nil, true},
+		{"both channels", func(p *device.Profile) {
+			p.SecondChannel = &device.Calibration{CalibrationFactor: 10}
+		}, nil, true},
+		{"gain", func(p *device.Profile) { p.Gain = 100 }, device.ErrInvalidGain, false},
+		{"sample rate", func(p *device.Profile) { p.SampleRate = 50 }, device.ErrInvalidSampleRate, false},
+		{"channel", func(p *device.Profile) { p.Channel = 3 }, device.ErrInvalidChannel, false},
+		{"LDO", func(p *device.Profile) { p.LDO = 5 }, device.ErrInvalidLDO, false},
+		{"calibration factor", func(p *device.Profile) { p.CalibrationFactor = 0 }, nil, false},
+		{"second channel factor", func(p *device.Profile) {
+			p.SecondChannel = &device.Calibration{}
+		}, nil, false},
+		{"temperature interval", func(p *device.Profile) { p.TemperatureInterval = -1 }, nil, false},
+		{"PGA capacitor on both channels", func(p *device.Profile) {
+			options := device.DefaultOptions()
+			options.PGACapacitor = true
+			p.Options = &options
+			p.SecondChannel = &device.Calibration{CalibrationFactor: 10}
+		}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := device.DefaultProfile()
+			tt.change(&p)
+			err := p.Validate()
+			switch {
+			case tt.valid && err != nil:
+				t.Errorf("got %v, want valid", err)
+			case !tt.valid && err == nil:
+				t.Error("got no error")
+			case tt.err != nil && !errors.Is(err, tt.err):
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+
+			// an invalid profile is never written
+			path := filepath.Join(t.TempDir(), "nau7802.json")
+			if err = p.Save(path); (err == nil) != tt.valid {
+				t.Errorf("saving: %v", err)
+			}
+		})
+	}
+}
+
+// TestProfileRoundTrip tares and calibrates a scale, saves the result and
+// starts another one with the profile.
+func TestProfileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nau7802.json")
+
+	// without a file the callers keep the defaults
+	p, err := device.LoadProfile(path)
+	if !errors.Is(err, fs.ErrNotExist) || !reflect.DeepEqual(p, device.DefaultProfile()) {
+		t.Fatalf("got %+v, %v, want the default profile and %v", p, err, fs.ErrNotExist)
+	}
+
+	chip, nau7802 := initialized(t, func(chip *sim.NAU7802) {
+		chip.SetRaw(device.NAU7802_CHANNEL_1, 20000)
+	})
+	if err = nau7802.CalculateZeroOffset(2); err != nil {
+		t.Fatal(err)
+	}
+	chip.SetRaw(device.NAU7802_CHANNEL_1, 45000)
+	if err = nau7802.CalculateCalibrationFactor(100, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	p.Calibration = nau7802.GetChannelCalibration(device.NAU7802_CHANNEL_1)
+	p.SampleRate = 320
+	if err = p.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := device.LoadProfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, p) {
+		t.Fatalf("loaded %+v, want %+v", loaded, p)
+	}
+	if loaded.ZeroOffset != 20000 || loaded.CalibrationFactor != 250 {
+		t.Errorf("zero offset %d, factor %v, want 20000 and 250", loaded.ZeroOffset, loaded.CalibrationFactor)
+	}
+
+	other := sim.New()
+	other.SetRaw(device.NAU7802_CHANNEL_1, 32500)
+	restarted := device.New(other)
+	if err = restarted.InitializeProfile(loaded); err != nil {
+		t.Fatal(err)
+	}
+	weight, err := restarted.GetWeight(false, 2)
+	if err != nil || math.Abs(weight-50) > 1e-9 {
+		t.Errorf("weight %v, %v on the restarted scale, want 50", weight, err)
+	}
+}
@@ -0,0 +1,31 @@
+package device
+
+import "time"
+
+// SamplesPerSecond returns the conversion rate for one of the NAU7802_SPS_*
+// values or 0 for reserved values.
+func SamplesPerSecond(rate int) int {
+	switch rate {
+	case NAU7802_SPS_10:
+		return 10
+	case NAU7802_SPS_20:
+		return 20
+	case NAU7802_SPS_40:
+		return 40
+	case NAU7802_SPS_80:
+		return 80
+	case NAU7802_SPS_320:
+		return 320
+	}
+	return 0
+}
+
+// ConversionTime returns the duration of one conversion for one of the
+// NAU7802_SPS_* values or 0 for reserved values.
+func ConversionTime(rate int) time.Duration {
+	sps := SamplesPerSecond(rate)
+	if sps == 0 {
+		return 0
+	}
+	return time.Second / time.Duration(sps)
+}
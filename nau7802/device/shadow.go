@@ -0,0 +1,147 @@
+package device
+
+const registerCount = NAU7802_DEVICE_REV + 1
+
+// volatile are the status bits the chip changes on its own. They are never
+// taken from the shadow copy and are kept cleared in it.
+var volatile = [registerCount]byte{
+	NAU7802_PU_CTRL: 1<<NAU7802_PU_CTRL_PUR | 1<<NAU7802_PU_CTRL_CR,
+	NAU7802_CTRL2:   1<<NAU7802_CTRL2_CALS | 1<<NAU7802_CTRL2_CAL_ERROR,
+}
+
+// shadowed reports whether the driver keeps a copy of reg. These are the
+// configuration registers only the driver writes to. OCAL and GCAL are left
+// out, the calibrations of the chip change them.
+func shadowed(reg byte) bool {
+	switch reg {
+	case NAU7802_PU_CTRL, NAU7802_CTRL1, NAU7802_CTRL2, NAU7802_I2C_CONTROL,
+		NAU7802_ADC, NAU7802_PGA, NAU7802_PGA_PWR:
+		return true
+	}
+	return false
+}
+
+// shadow is the copy of the configuration registers.
+type shadow struct {
+	value [registerCount]byte
+	valid [registerCount]bool
+}
+
+// BusStats counts the transactions on the bus, every ReadReg and WriteReg
+// is one transaction regardless of its length.
+type BusStats struct {
+	Reads  int
+	Writes int
+}
+
+// GetBusStats returns the transactions since New or ResetBusStats.
+func (n *NAU7802) GetBusStats() BusStats {
+	return n.stats
+}
+
+func (n *NAU7802) ResetBusStats() {
+	n.stats = BusStats{}
+}
+
+// InvalidateCache drops the shadow copy of the registers, the next access
+// reads them from the chip again. It is needed if something besides the
+// driver changed the registers, e.g. a brown-out reset of the chip.
+func (n *NAU7802) InvalidateCache() {
+	n.shadow = shadow{}
+}
+
+// busRead reads buf from the chip starting at reg and updates the shadow
+// copy. ADC is skipped, it reads OTP while RD_OTP_SEL is set.
+func (n *NAU7802) busRead(reg byte, buf []byte) error {
+	n.stats.Reads++
+
+	if err := n.Dev.ReadReg(reg, buf); err != nil {
+		return err
+	}
+
+	for i, b := range buf {
+		if r := reg + byte(i); r != NAU7802_ADC {
+			n.remember(r, b)
+		}
+	}
+
+	return nil
+}
+
+// busWrite writes buf to the chip starting at reg and updates the shadow
+// copy. A register reset drops it.
+func (n *NAU7802) busWrite(reg byte, buf []byte) error {
+	n.stats.Writes++
+
+	if err := n.Dev.WriteReg(reg, buf); err != nil {
+		// the write may or may not have reached the chip
+		for i := range buf {
+			if r := int(reg) + i; r < registerCount {
+				n.shadow.valid[r] = false
+			}
+		}
+		return err
+	}
+
+	if reg == NAU7802_PU_CTRL && buf[0]&(1<<NAU7802_PU_CTRL_RR) != 0 {
+		n.InvalidateCache()
+		return nil
+	}
+
+	for i, b := range buf {
+		n.remember(reg+byte(i), b)
+	}
+
+	return nil
+}
+
+func (n *NAU7802) remember(reg, value byte) {
+	if int(reg) < registerCount && shadowed(reg) {
+		n.shadow.value[reg] = value &^ volatile[reg]
+		n.shadow.valid[reg] = true
+	}
+}
+
+// register returns the configuration bits of reg, from the shadow copy if
+// possible. The volatile status bits are always returned cleared.
+func (n *NAU7802) register(reg byte) (byte, error) {
+	if int(reg) < registerCount && n.shadow.valid[reg] {
+		return n.shadow.value[reg], nil
+	}
+
+	value, err := n.GetRegister(reg)
+	if err != nil {
+		return 0, err
+	}
+
+	if int(reg) < registerCount {
+		return value[0] &^ volatile[reg], nil
+	}
+	return value[0], nil
+}
+
+// update sets the bits of reg selected by mask to value in a single write.
+// Nothing is written if the bits already have that value.
+func (n *NAU7802) update(reg, mask, value byte) error {
+	old, err := n.register(reg)
+	if err != nil {
+		return err
+	}
+
+	val := old&^mask | value&mask
+	if val == old {
+		return nil
+	}
+
+	return n.SetRegister(reg, []byte{val})
+}
+
+// readBlock reads the consecutive registers from first to last with one
+// transaction using the auto-increment of the register address.
+func (n *NAU7802) readBlock(first, last byte) ([]byte, error) {
+	buf := make([]byte, last-first+1)
+	if err := n.busRead(first, buf); err != nil {
+		return nil, &RegisterError{Op: "read", Register: first, Err: err}
+	}
+	return buf, nil
+}
@@ -0,0 +1,30 @@
+package device_test
+
+import (
+	"testing"
+
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+)
+
+func TestShadowRegisters(t *testing.T) {
+	chip, nau7802 := initialized(t, nil)
+
+	// the default profile already has these settings
+	nau7802.ResetBusStats()
+	nau7802.SetGain(device.NAU7802_GAIN_128)
+	nau7802.SetSampleRate(device.NAU7802_SPS_80)
+	nau7802.SetChannel(device.NAU7802_CHANNEL_1)
+	if stats := nau7802.GetBusStats(); stats != (device.BusStats{}) {
+		t.Errorf("unchanged settings took %+v", stats)
+	}
+
+	if err := nau7802.SetGain(device.NAU7802_GAIN_64); err != nil {
+		t.Fatal(err)
+	}
+	if stats := nau7802.GetBusStats(); stats != (device.BusStats{Writes: 1}) {
+		t.Errorf("a gain change took %+v, want a single write", stats)
+	}
+	if gain := chip.Register(device.NAU7802_CTRL1) & 0b111; gain != device.NAU7802_GAIN_64 {
+		t.Errorf("chip has gain code %d", gain)
+	}
+}
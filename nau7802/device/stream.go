@@ -0,0 +1,115 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// Flags describe the state of the ADC for a Sample.
+type Flags uint8
+
+const (
+	FlagOverRange Flags = 1 << iota
+	FlagUnderRange
+)
+
+// Sample is a single conversion delivered by Stream. If Err is set the
+// sample carries no reading, the stream keeps running and retries.
+// Temperature is the last temperature read, NaN if it was never read.
+type Sample struct {
+	Time        time.Time
+	Channel     int
+	Raw         int32
+	Weight      float64
+	Temperature float64
+	Flags       Flags
+	Err         error
+}
+
+// maxRetryDelay caps the back-off between retries after bus errors.
+const maxRetryDelay = time.Second
+
+// Stream reads every conversion of the chip and sends it on the returned
+// channel until ctx is cancelled, then the channel is closed. Bus errors and
+// timeouts are sent as samples with Err set and retried with increasing
+// delay. The driver must not be used otherwise while streaming.
+func (n *NAU7802) Stream(ctx context.Context) <-chan Sample {
+	return n.stream(ctx, n.nextSample)
+}
+
+func (n *NAU7802) stream(ctx context.Context, next func() Sample) <-chan Sample {
+	ch := make(chan Sample, 16)
+
+	go func() {
+		defer close(ch)
+
+		delay := ConversionTime(n.sampleRate)
+		retry := delay
+
+		for ctx.Err() == nil {
+			sample := next()
+
+			if sample.Err != nil {
+				if !send(ctx, ch, sample) {
+					return
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(retry):
+				}
+
+				if retry *= 2; retry > maxRetryDelay {
+					retry = maxRetryDelay
+				}
+				continue
+			}
+
+			retry = delay
+			if !send(ctx, ch, sample) {
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+func (n *NAU7802) nextSample() Sample {
+	if n.temperatureDue() {
+		if _, err := n.ReadTemperature(); err != nil {
+			return Sample{Time: time.Now(), Channel: n.channel, Err: err}
+		}
+	}
+
+	raw, err := n.GetNextReading()
+	sample := Sample{Time: time.Now(), Channel: n.channel, Raw: raw, Temperature: math.NaN()}
+	if !n.tempAt.IsZero() {
+		sample.Temperature = n.temperature
+	}
+
+	switch {
+	case errors.Is(err, ErrOverRange):
+		sample.Flags |= FlagOverRange
+	case errors.Is(err, ErrUnderRange):
+		sample.Flags |= FlagUnderRange
+	case err != nil:
+		sample.Err = err
+		return sample
+	}
+
+	sample.Weight = n.toWeight(raw)
+	return sample
+}
+
+func send(ctx context.Context, ch chan<- Sample, sample Sample) bool {
+	select {
+	case ch <- sample:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,147 @@
+package device_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/sim"
+)
+
+// stalling is a simulated chip whose conversions can be stopped, CR stays
+// cleared then. It counts the reads of the bus.
+type stalling struct {
+	*sim.NAU7802
+
+	mu      sync.Mutex
+	stalled bool
+	reads   int
+}
+
+func (s *stalling) stall(stalled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stalled = stalled
+}
+
+func (s *stalling) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reads
+}
+
+func (s *stalling) ReadReg(reg byte, buf []byte) error {
+	if err := s.NAU7802.ReadReg(reg, buf); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reads++
+	if s.stalled && reg == device.NAU7802_PU_CTRL {
+		buf[0] &^= 1 << device.NAU7802_PU_CTRL_CR
+	}
+	return nil
+}
+
+func streaming(t *testing.T) (*stalling, *device.NAU7802) {
+	t.Helper()
+
+	chip := &stalling{NAU7802: sim.New()}
+	chip.SetRaw(device.NAU7802_CHANNEL_1, 1000)
+	nau7802 := device.New(chip)
+	if err := nau7802.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return chip, nau7802
+}
+
+// next returns the next sample of the stream, it fails the test if none
+// arrives within a second.
+func next(t *testing.T, samples <-chan device.Sample) device.Sample {
+	t.Helper()
+
+	select {
+	case sample, ok := <-samples:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return sample
+	case <-time.After(time.Second):
+		t.Fatal("no sample within a second")
+	}
+	return device.Sample{}
+}
+
+func TestStreamCancel(t *testing.T) {
+	chip, nau7802 := streaming(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	samples := nau7802.Stream(ctx)
+
+	for i := 0; i < 3; i++ {
+		if sample := next(t, samples); sample.Err != nil || sample.Raw != 1000 {
+			t.Fatalf("sample %d: raw %d, %v, want 1000", i, sample.Raw, sample.Err)
+		}
+	}
+
+	// the samples buffered before are drained, then the stream closes
+	cancel()
+	closed := time.After(time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-samples:
+		case <-closed:
+			t.Fatal("stream not closed a second after the cancellation")
+		}
+	}
+
+	// the goroutine is gone and does not use the bus any more
+	reads := chip.count()
+	time.Sleep(100 * time.Millisecond)
+	if after := chip.count(); after != reads {
+		t.Errorf("%d reads of the bus after the stream closed", after-reads)
+	}
+}
+
+func TestStreamTimeout(t *testing.T) {
+	chip, nau7802 := streaming(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	samples := nau7802.Stream(ctx)
+
+	if sample := next(t, samples); sample.Err != nil {
+		t.Fatal(sample.Err)
+	}
+
+	chip.stall(true)
+	for {
+		sample := next(t, samples)
+		if errors.Is(sample.Err, device.ErrTimeout) {
+			break
+		}
+		if sample.Err != nil {
+			t.Fatalf("got %v, want %v", sample.Err, device.ErrTimeout)
+		}
+	}
+
+	// the stream keeps running and recovers
+	chip.stall(false)
+	for {
+		sample := next(t, samples)
+		if sample.Err == nil {
+			if sample.Raw != 1000 {
+				t.Errorf("raw %d after the timeout, want 1000", sample.Raw)
+			}
+			break
+		}
+	}
+}
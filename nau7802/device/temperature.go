@@ -0,0 +1,104 @@
+package device
+
+import (
+	"math"
+	"time"
+)
+
+// Typical output of the internal temperature sensor from the datasheet. The
+// estimate is only as good as these, TemperatureOffset corrects a single
+// chip against a thermometer.
+const (
+	TempSensorVolts25        = 0.109  // V at 25°C
+	TempSensorVoltsPerDegree = 360e-6 // V per °C
+)
+
+// TemperatureCode returns the conversion result for the temperature sensor
+// at celsius with a gain of 1 and the reference voltage vref. The input
+// range of the ADC is ±vref/2.
+func TemperatureCode(celsius, vref float64) int32 {
+	volts := TempSensorVolts25 + (celsius-25)*TempSensorVoltsPerDegree
+	return int32(math.Round(volts / (vref / 2) * (NAU7802_ADC_MAX + 1)))
+}
+
+// TemperatureFromCode is the inverse of TemperatureCode.
+func TemperatureFromCode(code int32, vref float64) float64 {
+	volts := float64(code) * (vref / 2) / (NAU7802_ADC_MAX + 1)
+	return 25 + (volts-TempSensorVolts25)/TempSensorVoltsPerDegree
+}
+
+// ReadTemperature switches the ADC to the internal temperature sensor,
+// converts it with a gain of 1 and switches back to the bridge. The gain
+// is restored and the next reading discards the settling conversions. The
+// reference voltage is taken from VLDO, with an external AVDD the result is
+// off unless TemperatureOffset accounts for it.
+//
+// The temperature is kept to compensate the readings of channels with a
+// TempCoefficient.
+func (n *NAU7802) ReadTemperature() (float64, error) {
+	ctrl1, err := n.register(NAU7802_CTRL1)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = n.SetGain(NAU7802_GAIN_1); err != nil {
+		return 0, err
+	}
+	if err = n.SetBit(NAU7802_I2C_CONTROL_TS, NAU7802_I2C_CONTROL, true); err != nil {
+		return 0, err
+	}
+
+	n.discard = n.settle
+	code, err := n.GetNextReading()
+
+	// switch back even if the reading failed
+	if serr := n.SetBit(NAU7802_I2C_CONTROL_TS, NAU7802_I2C_CONTROL, false); err == nil {
+		err = serr
+	}
+	if serr := n.SetRegister(NAU7802_CTRL1, []byte{ctrl1}); err == nil {
+		err = serr
+	}
+	n.discard = n.settle
+
+	if err != nil {
+		return 0, err
+	}
+
+	vref := 4.5 - 0.3*float64(ldoField.Value(ctrl1))
+	n.temperature = TemperatureFromCode(code, vref) + n.tempOffset
+	n.tempAt = time.Now()
+
+	return n.temperature, nil
+}
+
+// GetTemperature returns the last temperature read and when it was read.
+// The time is zero if the temperature was never read.
+func (n *NAU7802) GetTemperature() (float64, time.Time) {
+	return n.temperature, n.tempAt
+}
+
+// SetTemperatureInterval makes Stream and StreamChannels read the
+// temperature every interval, zero turns it off.
+func (n *NAU7802) SetTemperatureInterval(interval time.Duration) {
+	n.tempInterval = interval
+}
+
+// SetTemperatureOffset sets a correction in °C added to the estimate of
+// the temperature sensor.
+func (n *NAU7802) SetTemperatureOffset(offset float64) {
+	n.tempOffset = offset
+}
+
+// temperatureDue reports whether the periodic temperature reading is due.
+func (n *NAU7802) temperatureDue() bool {
+	return n.tempInterval > 0 && time.Since(n.tempAt) >= n.tempInterval
+}
+
+// compensate removes the temperature drift from a reading of the selected
+// channel.
+func (n *NAU7802) compensate(raw int32) int32 {
+	if n.tempAt.IsZero() {
+		return raw
+	}
+	return n.cal[n.channel].Compensate(raw, n.temperature)
+}
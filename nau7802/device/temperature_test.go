@@ -0,0 +1,61 @@
+package device_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/sim"
+)
+
+func TestReadTemperature(t *testing.T) {
+	chip, nau7802 := initialized(t, func(chip *sim.NAU7802) { chip.Temperature = 31.5 })
+
+	temp, err := nau7802.ReadTemperature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(temp-31.5) > 0.1 {
+		t.Errorf("read %.2f°C, want 31.5°C", temp)
+	}
+	if chip.Register(device.NAU7802_I2C_CONTROL)&(1<<device.NAU7802_I2C_CONTROL_TS) != 0 {
+		t.Error("TS still set")
+	}
+}
+
+func TestTemperatureCompensation(t *testing.T) {
+	tests := []struct {
+		name    string
+		celsius float64
+	}{
+		{"reference", 25},
+		{"cold", 10},
+		{"warm", 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chip, nau7802 := initialized(t, func(chip *sim.NAU7802) {
+				chip.Drift = 200
+				chip.SetRaw(device.NAU7802_CHANNEL_1, 5000)
+			})
+			cal := nau7802.GetChannelCalibration(device.NAU7802_CHANNEL_1)
+			cal.ZeroOffset = 5000
+			cal.TempCoefficient = 200
+			cal.ReferenceTemp = 25
+			nau7802.SetChannelCalibration(device.NAU7802_CHANNEL_1, cal)
+
+			chip.Temperature = tt.celsius
+			if _, err := nau7802.ReadTemperature(); err != nil {
+				t.Fatal(err)
+			}
+			weight, err := nau7802.GetWeight(true, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(weight) > 1 {
+				t.Errorf("weight %.2f at %v°C, want 0", weight, tt.celsius)
+			}
+		})
+	}
+}
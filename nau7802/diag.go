@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+)
+
+// diag prints the registers with their decoded fields, the revision code,
+// the OTP bytes and the problems found in the register settings. Unless
+// -init is given the chip is inspected as it is, without a reset.
+//
+// "diag poke REG VALUE" writes a single register and prints it before and
+// after the write.
+func diag(profile device.Profile, args []string) {
+	var nau7802 *device.NAU7802
+	var err error
+
+	if initFirst {
+		nau7802, err = Initialize(profile)
+	} else {
+		nau7802, err = Open()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer nau7802.Close()
+
+	if len(args) > 0 {
+		if args[0] != "poke" || len(args) != 3 {
+			log.Fatal("usage: diag [poke REG VALUE]")
+		}
+		poke(nau7802, args[1], args[2])
+		return
+	}
+
+	dump, err := nau7802.DumpRegisters()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, r := range dump {
+		printRegister(r)
+	}
+
+	rev, err := nau7802.GetRevisionCode()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("\nrevision code: 0x%02X\n", rev[0])
+
+	otp, err := nau7802.ReadOTP()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("OTP: % X\n", otp)
+
+	config, err := nau7802.ReadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, _ := json.MarshalIndent(config, "", "  ")
+	fmt.Printf("configuration: %s\n", data)
+
+	problems, err := nau7802.Diagnose()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println()
+	if len(problems) == 0 {
+		fmt.Println("no problems found")
+	}
+	for _, p := range problems {
+		fmt.Println("problem:", p)
+	}
+}
+
+func printRegister(r device.RegisterValue) {
+	fmt.Printf("0x%02X %-12s 0x%02X %08b  %s\n", r.Address, r.Name, r.Value, r.Value, r.Decode())
+}
+
+func poke(nau7802 *device.NAU7802, regArg, valueArg string) {
+	reg, err := strconv.ParseUint(regArg, 0, 8)
+	if err != nil || reg > device.NAU7802_DEVICE_REV {
+		log.Fatalf("invalid register %q", regArg)
+	}
+	value, err := strconv.ParseUint(valueArg, 0, 8)
+	if err != nil {
+		log.Fatalf("invalid value %q", valueArg)
+	}
+
+	info := device.RegisterInfo{Address: byte(reg), Name: "reserved"}
+	for _, r := range device.Registers {
+		if r.Address == byte(reg) {
+			info = r
+		}
+	}
+
+	read := func() device.RegisterValue {
+		v, err := nau7802.GetRegister(byte(reg))
+		if err != nil {
+			log.Fatal(err)
+		}
+		return device.RegisterValue{RegisterInfo: info, Value: v[0]}
+	}
+
+	printRegister(read())
+	if err = nau7802.SetRegister(byte(reg), []byte{byte(value)}); err != nil {
+		log.Fatal(err)
+	}
+	printRegister(read())
+}
@@ -1,566 +1,482 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
-	"golang.org/x/exp/io/i2c"
+	"github.com/SimonWaldherr/rpi-examples/calibration"
+	"github.com/SimonWaldherr/rpi-examples/filter"
+	"github.com/SimonWaldherr/rpi-examples/i2cconf"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/sim"
+	"github.com/SimonWaldherr/rpi-examples/scale"
 )
 
-const (
-	DEVICE_ADDRESS = 0x2A
-
-	// Register Map
-	NAU7802_PU_CTRL     = 0x00
-	NAU7802_CTRL1       = 0x01
-	NAU7802_CTRL2       = 0x02
-	NAU7802_OCAL1_B2    = 0x03
-	NAU7802_OCAL1_B1    = 0x04
-	NAU7802_OCAL1_B0    = 0x05
-	NAU7802_GCAL1_B3    = 0x06
-	NAU7802_GCAL1_B2    = 0x07
-	NAU7802_GCAL1_B1    = 0x08
-	NAU7802_GCAL1_B0    = 0x09
-	NAU7802_OCAL2_B2    = 0x0A
-	NAU7802_OCAL2_B1    = 0x0B
-	NAU7802_OCAL2_B0    = 0x0C
-	NAU7802_GCAL2_B3    = 0x0D
-	NAU7802_GCAL2_B2    = 0x0E
-	NAU7802_GCAL2_B1    = 0x0F
-	NAU7802_GCAL2_B0    = 0x10
-	NAU7802_I2C_CONTROL = 0x11
-	NAU7802_ADCO_B2     = 0x12
-	NAU7802_ADCO_B1     = 0x13
-	NAU7802_ADCO_B0     = 0x14
-	NAU7802_ADC         = 0x15 // Shared ADC and OTP 32:24
-	NAU7802_OTP_B1      = 0x16 // OTP 23:16 or 7:0?
-	NAU7802_OTP_B0      = 0x17 // OTP 15:8
-	NAU7802_PGA         = 0x1B
-	NAU7802_PGA_PWR     = 0x1C
-	NAU7802_DEVICE_REV  = 0x1F
-
-	// Bits within the PU_CTRL register
-	NAU7802_PU_CTRL_RR    = 0
-	NAU7802_PU_CTRL_PUD   = 1
-	NAU7802_PU_CTRL_PUA   = 2
-	NAU7802_PU_CTRL_PUR   = 3
-	NAU7802_PU_CTRL_CS    = 4
-	NAU7802_PU_CTRL_CR    = 5
-	NAU7802_PU_CTRL_OSCS  = 6
-	NAU7802_PU_CTRL_AVDDS = 7
-
-	// Bits within the CTRL1 register
-	NAU7802_CTRL1_GAIN     = 2
-	NAU7802_CTRL1_VLDO     = 5
-	NAU7802_CTRL1_DRDY_SEL = 6
-	NAU7802_CTRL1_CRP      = 7
-
-	// Bits within the CTRL2 register
-	NAU7802_CTRL2_CALMOD    = 0
-	NAU7802_CTRL2_CALS      = 2
-	NAU7802_CTRL2_CAL_ERROR = 3
-	NAU7802_CTRL2_CRS       = 4
-	NAU7802_CTRL2_CHS       = 7
-
-	// Bits within the PGA register
-	NAU7802_PGA_CHP_DIS    = 0
-	NAU7802_PGA_INV        = 3
-	NAU7802_PGA_BYPASS_EN  = 4
-	NAU7802_PGA_OUT_EN     = 5
-	NAU7802_PGA_LDOMODE    = 6
-	NAU7802_PGA_RD_OTP_SEL = 7
-
-	// Bits within the PGA PWR register
-	NAU7802_PGA_PWR_PGA_CURR       = 0
-	NAU7802_PGA_PWR_ADC_CURR       = 2
-	NAU7802_PGA_PWR_MSTR_BIAS_CURR = 4
-	NAU7802_PGA_PWR_PGA_CAP_EN     = 7
-
-	// Allowed Low drop out regulator voltages
-	NAU7802_LDO_2V4 = 0b111
-	NAU7802_LDO_2V7 = 0b110
-	NAU7802_LDO_3V0 = 0b101
-	NAU7802_LDO_3V3 = 0b100
-	NAU7802_LDO_3V6 = 0b011
-	NAU7802_LDO_3V9 = 0b010
-	NAU7802_LDO_4V2 = 0b001
-	NAU7802_LDO_4V5 = 0b000
-
-	// Allowed gains
-	NAU7802_GAIN_128 = 0b111
-	NAU7802_GAIN_64  = 0b110
-	NAU7802_GAIN_32  = 0b101
-	NAU7802_GAIN_16  = 0b100
-	NAU7802_GAIN_8   = 0b011
-	NAU7802_GAIN_4   = 0b010
-	NAU7802_GAIN_2   = 0b001
-	NAU7802_GAIN_1   = 0b000
-
-	// Allowed samples per second
-	NAU7802_SPS_320 = 0b111
-	NAU7802_SPS_80  = 0b011
-	NAU7802_SPS_40  = 0b010
-	NAU7802_SPS_20  = 0b001
-	NAU7802_SPS_10  = 0b000
-
-	// Select between channel values
-	NAU7802_CHANNEL_1 = 0
-	NAU7802_CHANNEL_2 = 1
-
-	// Calibration state
-	NAU7802_CAL_SUCCESS     = 0
-	NAU7802_CAL_IN_PROGRESS = 1
-	NAU7802_CAL_FAILURE     = 2
-)
-
-type NAU7802 struct {
-	Dev               *i2c.Device
-	zeroOffset        int32
-	calibrationFactor float64
-}
-
-func NewNAU7802() (*NAU7802, error) {
-	dev, err := i2c.Open(&i2c.Devfs{Dev: "/dev/i2c-1"}, DEVICE_ADDRESS)
+var simulate bool
+var profilePath string
+var samples int
+var knownWeight float64
+var weightList string
+var fitKind string
+var calChannel int
+var afeMode string
+var initFirst bool
+var i2cDevice *i2cconf.Setting
+var monitor *scale.MonitorOptions
+var record *scale.RecordOptions
+var tarePath string
+var tareSpec string
+
+// Open connects to the chip, or the simulator, without touching its
+// registers.
+func Open() (*device.NAU7802, error) {
+	if simulate {
+		chip := sim.New()
+		chip.Noise = 50
+		chip.SetRaw(device.NAU7802_CHANNEL_1, -22872)
+		chip.SetRaw(device.NAU7802_CHANNEL_2, 10250)
+		return device.New(chip), nil
+	}
+
+	return device.NewNAU7802(i2cDevice.Bus, int(i2cDevice.Address))
+}
+
+func Initialize(profile device.Profile) (*device.NAU7802, error) {
+	nau7802, err := Open()
 	if err != nil {
 		return nil, err
 	}
 
-	return &NAU7802{Dev: dev}, nil
+	if err := nau7802.InitializeProfile(profile); err != nil {
+		nau7802.Close()
+		return nil, err
+	}
+
+	return nau7802, nil
 }
 
-func (n *NAU7802) isConnected() bool {
-	data := make([]byte, 1)
-	err := n.Dev.ReadReg(DEVICE_ADDRESS, data)
+func loadProfile() device.Profile {
+	profile, err := device.LoadProfile(profilePath)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("no profile at %s, using defaults", profilePath)
+		return device.DefaultProfile()
+	}
 	if err != nil {
-		return false // Sensor did not ACK
+		log.Fatal(err)
 	}
-	return true // All good
+	return profile
 }
 
-func (n *NAU7802) getBit(bit, register byte) (bool, error) {
-	buf := make([]byte, 1)
+// channelCalibration returns the calibration of the channel selected with
+// -channel. Calibrating the channel not in use yet turns on dual-channel
+// operation.
+func channelCalibration(profile *device.Profile) (int, *device.Calibration) {
+	channel := calChannel
+	if channel == 0 {
+		channel = profile.Channel
+	}
 
-	err := n.Dev.ReadReg(register, buf)
+	code, err := device.ChannelCode(channel)
 	if err != nil {
-		return false, err
+		log.Fatal(err)
 	}
 
-	return (buf[0]>>bit)&1 == 1, nil
+	cal := profile.ForChannel(channel)
+	if cal == nil {
+		profile.SecondChannel = &device.Calibration{CalibrationFactor: 1}
+		cal = profile.SecondChannel
+	}
+
+	return code, cal
 }
 
-func (n *NAU7802) setBit(bit, register byte, value bool) error {
-	buf := make([]byte, 15)
-	err := n.Dev.ReadReg(register, buf)
+// initializeChannel initializes the chip and selects the channel to tare or
+// calibrate.
+func initializeChannel(profile device.Profile, channel int) *device.NAU7802 {
+	nau7802, err := Initialize(profile)
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
 
-	data := buf[0]
-
-	if value {
-		data |= (1 << bit)
-	} else {
-		data &= ^(1 << bit)
+	if err = nau7802.SetChannel(channel); err != nil {
+		nau7802.Close()
+		log.Fatal(err)
 	}
 
-	writeBuf := []byte{data}
-
-	return n.Dev.WriteReg(byte(register), writeBuf)
+	return nau7802
 }
 
-func (n *NAU7802) getRegister(register byte) ([]byte, error) {
-	buf := make([]byte, 1)
+// tare measures the empty scale and stores the result as zero offset.
+func tare(profile device.Profile) {
+	channel, cal := channelCalibration(&profile)
 
-	err := n.Dev.ReadReg(register, buf)
+	nau7802 := initializeChannel(profile, channel)
+	defer nau7802.Close()
 
-	if err != nil {
-		fmt.Printf("Error reading register %d: %v\n", register, err)
-		return []byte{}, err
+	if err := nau7802.CalculateZeroOffset(samples); err != nil {
+		log.Fatal(err)
 	}
 
-	return buf, nil
-}
-
-func (n *NAU7802) setRegister(register byte, value []byte) error {
-	return n.Dev.WriteReg(register, value)
-}
-
-func (n *NAU7802) available() bool {
-	data := make([]byte, 1)
-	err := n.Dev.ReadReg(NAU7802_PU_CTRL, data)
-	if err != nil {
-		return false
+	cal.ZeroOffset = nau7802.GetZeroOffset()
+	if err := profile.Save(profilePath); err != nil {
+		log.Fatal(err)
 	}
-	return data[0]&(1<<NAU7802_PU_CTRL_CR) != 0
-}
 
-func (n *NAU7802) getReading() (int32, error) {
-	data := make([]byte, 3)
+	fmt.Printf("zero offset of channel %d set to %d\n", channel+1, cal.ZeroOffset)
+}
 
-	err := n.Dev.ReadReg(NAU7802_ADCO_B2, data)
-	if err != nil {
-		return 0, err // Sensor did not ACK
+// calibrate measures the known weight on the tared scale and stores the
+// resulting calibration factor.
+func calibrate(profile device.Profile) {
+	if knownWeight <= 0 {
+		log.Fatal("calibrate needs the known weight, e.g. -weight 100")
 	}
 
-	value := int32((uint(data[0]) << 16) | (uint(data[1]) << 8) | uint(data[2]))
-	return value, nil
-}
+	channel, cal := channelCalibration(&profile)
 
-func (n *NAU7802) getAverage(average int) (int32, error) {
-	var sum int32
-	for i := 0; i < average; i++ {
-		data, err := n.getReading()
-		if err != nil {
-			return 0, err
-		}
+	nau7802 := initializeChannel(profile, channel)
+	defer nau7802.Close()
 
-		time.Sleep(1 * time.Millisecond)
+	if err := nau7802.CalculateCalibrationFactor(knownWeight, samples); err != nil {
+		log.Fatal(err)
+	}
 
-		sum += data
+	cal.CalibrationFactor = nau7802.GetCalibrationFactor()
+	cal.Curve = nil
+	if err := profile.Save(profilePath); err != nil {
+		log.Fatal(err)
 	}
 
-	return sum / int32(average), nil
+	fmt.Printf("calibration factor of channel %d set to %v\n", channel+1, cal.CalibrationFactor)
 }
 
-func (n *NAU7802) calculateZeroOffset(average int) error {
-	data, err := n.getAverage(average)
+// calibrateCurve asks for every reference weight in turn and fits a curve
+// through the tared zero and the measured points.
+func calibrateCurve(profile device.Profile) {
+	kind, degree, err := calibration.ParseKind(fitKind)
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
 
-	n.zeroOffset = data
-
-	return nil
-}
-
-func (n *NAU7802) setZeroOffset(offset int32) {
-	n.zeroOffset = offset
-}
-
-func (n *NAU7802) getZeroOffset() int32 {
-	return n.zeroOffset
-}
-
-func (n *NAU7802) calculateCalibrationFactor(knowWeight float64, average int) error {
-	data, err := n.getAverage(average)
-	if err != nil {
-		return err
+	var weights []float64
+	for _, field := range strings.Split(weightList, ",") {
+		w, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || w <= 0 {
+			log.Fatalf("invalid reference weight %q", field)
+		}
+		weights = append(weights, w)
 	}
 
-	n.calibrationFactor = float64(data-n.zeroOffset) / knowWeight
+	channel, cal := channelCalibration(&profile)
 
-	return nil
-}
+	nau7802 := initializeChannel(profile, channel)
+	defer nau7802.Close()
 
-func (n *NAU7802) setCalibrationFactor(factor float64) {
-	n.calibrationFactor = factor
-}
+	points := []calibration.Point{{Raw: 0, Weight: 0}}
+	stdin := bufio.NewReader(os.Stdin)
 
-func (n *NAU7802) getCalibrationFactor() float64 {
-	return n.calibrationFactor
-}
+	for _, w := range weights {
+		fmt.Printf("place %v on the scale and press enter ", w)
+		if _, err = stdin.ReadString('\n'); err != nil {
+			log.Fatal(err)
+		}
 
-func (n *NAU7802) getWeight(allowNegative bool, samples int) (float64, error) {
-	data, err := n.getAverage(samples)
-	if err != nil {
-		return 0, err
+		raw, err := nau7802.GetAverage(samples)
+		if err != nil {
+			log.Fatal(err)
+		}
+		points = append(points, calibration.Point{Raw: float64(raw - cal.ZeroOffset), Weight: w})
 	}
 
-	if !allowNegative && data < 0 {
-		return 0, errors.New("negative weight not allowed")
+	curve, err := calibration.Fit(kind, degree, points)
+	if err != nil {
+		log.Fatal(err)
 	}
+	curve.WriteReport(os.Stdout, points)
 
-	return float64(data-n.zeroOffset) / n.calibrationFactor, nil
-}
-
-func (n *NAU7802) setGain(gain int) error {
-	if gain < 0 || gain > 7 {
-		return errors.New("invalid gain value")
+	cal.Curve = &curve
+	if slope := curve.Slope(0); slope != 0 {
+		cal.CalibrationFactor = 1 / slope
 	}
-
-	value, err := n.getRegister(NAU7802_CTRL1)
-
-	if err != nil {
-		return err
+	if err = profile.Save(profilePath); err != nil {
+		log.Fatal(err)
 	}
 
-	val := make([]byte, 1)
-	val[0] = value[0]
-	val[0] &= 0b11111000
-	val[0] |= uint8(gain)
-
-	return n.setRegister(NAU7802_CTRL1, val)
+	fmt.Printf("%s curve of channel %d stored in %s\n", curve.Kind, channel+1, profilePath)
 }
 
-func (n *NAU7802) setLDO(ldo int) error {
-	if ldo < 0 || ldo > 7 {
-		return errors.New("invalid ldo value")
+// afe runs one of the calibrations of the chip and stores the resulting
+// calibration registers, so they are restored instead of calibrating again.
+func afe(profile device.Profile) {
+	modes := map[string]int{
+		"internal": device.NAU7802_CALMOD_INTERNAL,
+		"offset":   device.NAU7802_CALMOD_OFFSET,
+		"gain":     device.NAU7802_CALMOD_GAIN,
 	}
-
-	value, err := n.getRegister(NAU7802_CTRL1)
-
-	if err != nil {
-		return err
+	mode, ok := modes[afeMode]
+	if !ok {
+		log.Fatalf("unknown calibration mode %q, use internal, offset or gain", afeMode)
 	}
 
-	val := make([]byte, 1)
-	val[0] = value[0]
-	val[0] &= 0b11000111
-	val[0] |= uint8(ldo << 3)
-
-	n.setRegister(NAU7802_CTRL1, val)
+	channel, cal := channelCalibration(&profile)
 
-	return n.setBit(NAU7802_PU_CTRL_AVDDS, NAU7802_PU_CTRL, true)
-}
+	nau7802 := initializeChannel(profile, channel)
+	defer nau7802.Close()
 
-func (n *NAU7802) setSampleRate(rate int) error {
-	if rate < 0 || rate > 7 {
-		return errors.New("invalid sample rate value")
+	err := nau7802.CalibrateAFEMode(mode)
+	if status, serr := nau7802.CalibrationStatus(); serr == nil {
+		fmt.Printf("calibration status: %s\n", map[int]string{
+			device.NAU7802_CAL_SUCCESS:     "success",
+			device.NAU7802_CAL_IN_PROGRESS: "in progress",
+			device.NAU7802_CAL_FAILURE:     "failure",
+		}[status])
 	}
-
-	value, err := n.getRegister(NAU7802_CTRL2)
-
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
 
-	val := make([]byte, 1)
-	val[0] = value[0]
-	val[0] &= 0b10001111
-	val[0] |= uint8(rate << 4)
-
-	return n.setRegister(NAU7802_CTRL2, val)
-}
-
-func (n *NAU7802) setChannel(channel int) error {
-	if channel == NAU7802_CHANNEL_1 {
-		return n.setBit(NAU7802_CTRL2_CHS, NAU7802_CTRL2, false)
-	} else {
-		return n.setBit(NAU7802_CTRL2_CHS, NAU7802_CTRL2, true)
+	regs, err := nau7802.ReadAFECalibration(channel)
+	if err != nil {
+		log.Fatal(err)
 	}
-}
 
-func (n *NAU7802) calAFEinProgress() (bool, error) {
-	if val, err := n.getBit(NAU7802_CTRL2_CALS, NAU7802_CTRL2); err != nil && val {
-		return true, nil
+	cal.AFE = &regs
+	if err = profile.Save(profilePath); err != nil {
+		log.Fatal(err)
 	}
 
-	if val, err := n.getBit(NAU7802_CTRL2_CAL_ERROR, NAU7802_CTRL2); err != nil && val {
-		return false, errors.New("calibration error")
+	fmt.Printf("channel %d: OCAL 0x%06X, GCAL 0x%08X stored in %s\n", channel+1, uint32(regs.Offset)&0xFFFFFF, regs.Gain, profilePath)
+	if mode != device.NAU7802_CALMOD_INTERNAL {
+		fmt.Println("the readings changed, tare and calibrate the scale again")
 	}
-
-	return false, nil
 }
 
-func (n *NAU7802) beginnCalibrateAFE() error {
-	return n.setBit(NAU7802_CTRL2_CALS, NAU7802_CTRL2, true)
-}
+// openScale initializes the chip for run.
+func openScale(profile device.Profile) (scale.Scale, error) {
+	nau7802, err := Initialize(profile)
+	if err != nil {
+		return nil, err
+	}
 
-func (n *NAU7802) waitForCalibrateAFE(timeout time.Duration) error {
-	start := time.Now()
+	time.Sleep(500 * time.Millisecond)
 
-	for {
-		if time.Since(start) > timeout {
-			return errors.New("timeout")
-		}
+	// a chip that only reads 0 after power-up is initialized once more
+	if weight, _ := nau7802.GetWeight(true, 1); weight == 0 {
+		if weight, _ = nau7802.GetWeight(true, 1); weight == 0 {
+			nau7802.Reset()
+			nau7802.Close()
 
-		if inProgress, err := n.calAFEinProgress(); err != nil {
-			return err
-		} else if !inProgress {
-			return nil
+			if nau7802, err = Initialize(profile); err != nil {
+				return nil, err
+			}
 		}
-
-		time.Sleep(1 * time.Millisecond)
-	}
-	return nil
-}
-
-func (n *NAU7802) calibrateAFE() error {
-	if err := n.beginnCalibrateAFE(); err != nil {
-		return err
 	}
 
-	return n.waitForCalibrateAFE(100 * time.Millisecond)
-}
-
-func (n *NAU7802) reset() error {
-	n.setBit(NAU7802_PU_CTRL_RR, NAU7802_PU_CTRL, true)
-	time.Sleep(1 * time.Millisecond)
-
-	return n.setBit(NAU7802_PU_CTRL_RR, NAU7802_PU_CTRL, false)
+	return scale.NewNAU7802(nau7802), nil
 }
 
-func (n *NAU7802) powerUp() error {
-	err := n.setBit(NAU7802_PU_CTRL_PUD, NAU7802_PU_CTRL, true)
+func run(profile device.Profile) {
+	adc, spec, err := record.Open(func() (scale.Scale, error) { return openScale(profile) }, profile.Filter)
 	if err != nil {
-		return err
+		log.Fatal(err)
 	}
-	err = n.setBit(NAU7802_PU_CTRL_PUA, NAU7802_PU_CTRL, true)
+	chain, err := filter.Parse(spec)
 	if err != nil {
-		return err
-	}
-	counter := 0
-	for {
-		data := make([]byte, 1)
-		err = n.Dev.ReadReg(NAU7802_PU_CTRL, data)
-		if err != nil {
-			return err
-		}
-		if data[0]&(1<<NAU7802_PU_CTRL_PUR) != 0 {
-			break
-		}
-		time.Sleep(1 * time.Millisecond)
-		counter++
-		if counter > 100 {
-			return fmt.Errorf("PowerUp failed")
-		}
+		log.Fatal(err)
 	}
-	return nil
-}
 
-func (n *NAU7802) powerDown() error {
-	n.setBit(NAU7802_PU_CTRL_PUD, NAU7802_PU_CTRL, false)
-	n.setBit(NAU7802_PU_CTRL_PUA, NAU7802_PU_CTRL, false)
+	memory, err := scale.LoadTareMemory(tarePath)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	for i := 0; i < 100; i++ {
-		time.Sleep(1 * time.Millisecond)
+	// the zero of the start-up and its drift are taken care of by the
+	// zero tracking of monitor
+	s := scale.NewTared(monitor.Wrap(scale.NewFiltered(adc, chain)), memory, tarePath)
+	defer s.Close()
 
-		if val, err := n.getBit(NAU7802_PU_CTRL_PUR, NAU7802_PU_CTRL); err != nil && !val {
-			return nil
+	if tareSpec != "" {
+		if err = s.SelectTare(tareSpec); err != nil {
+			log.Fatal(err)
 		}
 	}
+	go tareCommands(s, os.Stdin)
 
-	return errors.New("timeout")
-}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-func (n *NAU7802) setIntPolarityHigh() error {
-	return n.setBit(NAU7802_CTRL1_CRP, NAU7802_CTRL1, false)
-}
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
 
-func (n *NAU7802) setIntPolarityLow() error {
-	return n.setBit(NAU7802_CTRL1_CRP, NAU7802_CTRL1, true)
-}
-
-func (n *NAU7802) getRevisionCode() ([]byte, error) {
-	return n.getRegister(byte(NAU7802_DEVICE_REV))
-}
+	var last scale.Reading
+	stream := s.Stream(ctx)
 
-var (
-	nau7802 = &NAU7802{}
-)
-
-func Initialize() (*NAU7802, error) {
-	nau7802, err := NewNAU7802()
-
-	nau7802.zeroOffset = 0
-	nau7802.calibrationFactor = 1.0
-
-	if err != nil {
-		log.Fatal("new nau", err)
-		return nil, err
-	}
-
-	if !nau7802.isConnected() {
-		log.Fatal("nau not connected")
-		if !nau7802.isConnected() {
-			log.Fatal("nau not connected")
-			return nil, err
+	for {
+		select {
+		case r, ok := <-stream:
+			if !ok {
+				return
+			}
+			if r.Err != nil && !errors.Is(r.Err, scale.ErrImplausible) {
+				log.Print(r.Err)
+				continue
+			}
+			last = r
+		case <-ticker.C:
+			switch {
+			case last.Time.IsZero():
+			case last.Err != nil:
+				fmt.Println("overload")
+			default:
+				printReading(last, s)
+			}
 		}
 	}
+}
 
-	nau7802.setChannel(NAU7802_CHANNEL_2)
-
-	err = nau7802.reset()
+// temperature prints the chip temperature next to the raw reading every
+// second, logging both over a day shows the drift for temp_coefficient.
+func temperature(profile device.Profile) {
+	nau7802, err := Initialize(profile)
 	if err != nil {
-		log.Fatal("reset", err)
-		return nil, err
-	}
-
-	if err = nau7802.powerUp(); err != nil {
 		log.Fatal(err)
-		return nil, err
 	}
+	defer nau7802.Close()
 
-	if err = nau7802.setLDO(NAU7802_LDO_3V3); err != nil {
-		log.Fatal(err)
-		return nil, err
-	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	if err = nau7802.setGain(NAU7802_GAIN_128); err != nil {
-		log.Fatal(err)
-		return nil, err
-	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 
-	if err = nau7802.setSampleRate(NAU7802_SPS_80); err != nil {
-		log.Fatal(err)
-		return nil, err
-	}
+	for {
+		temp, err := nau7802.ReadTemperature()
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	if err = nau7802.setRegister(NAU7802_ADC, []byte{0x30}); err != nil {
-		log.Fatal(err)
-		return nil, err
-	}
+		raw, err := nau7802.GetAverage(samples)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	time.Sleep(100 * time.Millisecond)
+		fmt.Printf("%.2f°C\traw %d\n", temp, raw)
 
-	if err = nau7802.setBit(NAU7802_PGA_PWR_PGA_CAP_EN, NAU7802_PGA_PWR, true); err != nil {
-		log.Fatal(err)
-		return nil, err
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
+}
 
-	time.Sleep(100 * time.Millisecond)
-
-	nau7802.setGain(NAU7802_GAIN_128)
-
-	if err = nau7802.calibrateAFE(); err != nil {
+// runDual prints the weights of both channels.
+func runDual(profile device.Profile) {
+	nau7802, err := Initialize(profile)
+	if err != nil {
 		log.Fatal(err)
-		return nil, err
 	}
+	defer nau7802.Close()
 
-	time.Sleep(100 * time.Millisecond)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	nau7802.setCalibrationFactor(153.52 / 2.5)
-	nau7802.setZeroOffset(16754344)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
 
-	return nau7802, nil
+	var last [2]device.Sample
+	stream := nau7802.StreamChannels(ctx)
+
+	for {
+		select {
+		case sample, ok := <-stream:
+			if !ok {
+				return
+			}
+			if sample.Err != nil {
+				log.Print(sample.Err)
+				continue
+			}
+			last[sample.Channel] = sample
+		case <-ticker.C:
+			for channel, sample := range last {
+				switch {
+				case sample.Time.IsZero():
+					fmt.Printf("channel %d: -\t", channel+1)
+				case sample.Flags != 0:
+					fmt.Printf("channel %d: overload\t", channel+1)
+				default:
+					fmt.Printf("channel %d: %.2f\t", channel+1, sample.Weight)
+				}
+			}
+			fmt.Println()
+		}
+	}
 }
 
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	nau7802, err := Initialize()
-	if err != nil {
+	flag.BoolVar(&simulate, "sim", false, "use a simulated NAU7802 instead of the I2C bus")
+	bus := i2cconf.NewOptions(flag.CommandLine)
+	i2cDevice = bus.Add("nau7802", "addr", i2cconf.NAU7802, device.DEVICE_ADDRESS)
+	flag.StringVar(&profilePath, "profile", "nau7802.json", "calibration profile to load and to store tare and calibrate results in")
+	flag.IntVar(&samples, "samples", 20, "number of conversions averaged by tare and calibrate")
+	flag.Float64Var(&knownWeight, "weight", 0, "known weight on the scale for calibrate")
+	flag.StringVar(&weightList, "weights", "", "comma separated reference weights for a multi-point calibrate")
+	flag.IntVar(&calChannel, "channel", 0, "channel 1 or 2 to tare or calibrate, defaults to the channel of the profile; using the other one enables dual-channel operation")
+	flag.StringVar(&afeMode, "mode", "internal", "afe calibration: internal, offset (empty scale) or gain (full scale load)")
+	flag.BoolVar(&initFirst, "init", false, "diag: initialize the chip with the profile before inspecting it")
+	flag.StringVar(&fitKind, "fit", calibration.Linear, "curve fitted by a multi-point calibrate: linear, piecewise or polyN")
+	record = scale.NewRecordOptions(flag.CommandLine)
+	flag.StringVar(&tarePath, "tares", "tares.json", "run: stored tares of containers")
+	flag.StringVar(&tareSpec, "tare", "", "run: preset tare weight or name of a stored tare")
+	monitor = scale.NewMonitorOptions(flag.CommandLine, scale.Stability{Window: 10, Tolerance: 1}, scale.ZeroTracking{Band: 1, Rate: 0.5, Initial: 1000})
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [run|tare|calibrate|afe|temp|diag [poke REG VALUE]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := bus.Resolve(); err != nil {
 		log.Fatal(err)
 	}
 
-	time.Sleep(500 * time.Millisecond)
-
-	initWeight, _ := nau7802.getWeight(true, 1)
-
-	if initWeight == 0 {
-		initWeight, _ = nau7802.getWeight(true, 1)
-
-		if initWeight == 0 {
-			nau7802.reset()
+	profile := loadProfile()
 
-			nau7802, err = Initialize()
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			initWeight, _ = nau7802.getWeight(true, 1)
+	switch flag.Arg(0) {
+	case "", "run":
+		// recordings are taken of the channel of the profile
+		if profile.Dual() && record.Record == "" && !record.Replaying() {
+			runDual(profile)
+		} else {
+			run(profile)
 		}
-	}
-
-	for {
-		weight, err := nau7802.getWeight(true, 1)
-		if err != nil {
-			log.Fatal(err)
+	case "tare":
+		tare(profile)
+	case "afe":
+		afe(profile)
+	case "diag":
+		diag(profile, flag.Args()[1:])
+	case "temp":
+		temperature(profile)
+	case "calibrate":
+		if weightList != "" {
+			calibrateCurve(profile)
+		} else {
+			calibrate(profile)
 		}
-
-		fmt.Println(weight - initWeight)
-		time.Sleep(500 * time.Millisecond)
+	default:
+		flag.Usage()
+		os.Exit(2)
 	}
 }
@@ -0,0 +1,357 @@
+// Package sim is an in-memory model of the NAU7802 register map. It
+// implements device.Bus, so the driver can be run on a machine without the
+// chip attached.
+package sim
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+)
+
+const (
+	registerCount = device.NAU7802_DEVICE_REV + 1
+
+	// Value of the DEVICE_REV register after power-on, the low nibble is
+	// the revision id 0xF.
+	revisionCode = 0x0F
+
+	maxCode = 1<<23 - 1
+	minCode = -1 << 23
+)
+
+var ErrInvalidRegister = errors.New("sim: invalid register")
+
+// NAU7802 is a simulated NAU7802. The zero value is not usable, use New.
+type NAU7802 struct {
+	// PowerUpTime is the delay between setting PUD and PUA and the chip
+	// reporting PUR.
+	PowerUpTime time.Duration
+	// CalibrationTime is how long CALS stays set after a calibration was
+	// started.
+	CalibrationTime time.Duration
+	// Noise is the peak amplitude of random noise added to every
+	// conversion.
+	Noise int32
+	// Now returns the current time, it defaults to time.Now.
+	Now func() time.Time
+
+	// Temperature of the chip in °C, converted when TS is set.
+	Temperature float64
+	// Drift is added to the bridge readings in counts per °C away from
+	// 25°C.
+	Drift float64
+
+	// CalibrationError makes every calibration end with CAL_ERROR set.
+	CalibrationError bool
+	// StuckCalibration keeps CALS set, calibrations never finish.
+	StuckCalibration bool
+	// StuckPowerUp keeps PUR cleared after PUD and PUA were set.
+	StuckPowerUp bool
+	// StuckPowerDown keeps PUR set after PUD and PUA were cleared.
+	StuckPowerDown bool
+
+	// OTP is read from the ADC, OTP_B1 and OTP_B0 registers while
+	// RD_OTP_SEL is set.
+	OTP [3]byte
+
+	mu         sync.Mutex
+	regs       [registerCount]byte
+	raw        [2]int32
+	powerUpAt  time.Time
+	calDoneAt  time.Time
+	calibrates bool
+	convStart  time.Time
+	lastRead   int64
+}
+
+// New returns a simulated chip in its power-on state.
+func New() *NAU7802 {
+	s := &NAU7802{
+		PowerUpTime:     200 * time.Microsecond,
+		CalibrationTime: 20 * time.Millisecond,
+		Now:             time.Now,
+		Temperature:     25,
+	}
+	s.reset()
+	return s
+}
+
+// SetRaw sets the raw ADC value the simulated bridge on channel produces.
+// Values outside the 24-bit range saturate like the real converter.
+func (s *NAU7802) SetRaw(channel int, value int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.raw[channel&1] = value
+}
+
+// Register returns the current content of a register without side effects.
+func (s *NAU7802) Register(reg byte) byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.update()
+	return s.regs[reg]
+}
+
+func (s *NAU7802) ReadReg(reg byte, buf []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if int(reg)+len(buf) > registerCount {
+		return ErrInvalidRegister
+	}
+
+	s.update()
+	if reg <= device.NAU7802_ADCO_B0 && int(reg)+len(buf) > device.NAU7802_ADCO_B2 {
+		s.latchConversion()
+	}
+	copy(buf, s.regs[reg:])
+
+	if s.regs[device.NAU7802_PGA]&(1<<device.NAU7802_PGA_RD_OTP_SEL) != 0 {
+		for i := range buf {
+			if r := int(reg) + i; r >= device.NAU7802_ADC && r <= device.NAU7802_OTP_B0 {
+				buf[i] = s.OTP[r-device.NAU7802_ADC]
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *NAU7802) WriteReg(reg byte, buf []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if int(reg)+len(buf) > registerCount {
+		return ErrInvalidRegister
+	}
+
+	s.update()
+	for i, b := range buf {
+		s.write(reg+byte(i), b)
+	}
+
+	return nil
+}
+
+func (s *NAU7802) reset() {
+	s.regs = [registerCount]byte{}
+	s.regs[device.NAU7802_DEVICE_REV] = revisionCode
+	s.setGCAL(device.NAU7802_CHANNEL_1, device.NAU7802_GCAL_DEFAULT)
+	s.setGCAL(device.NAU7802_CHANNEL_2, device.NAU7802_GCAL_DEFAULT)
+	s.powerUpAt = time.Time{}
+	s.calibrates = false
+	s.lastRead = 0
+}
+
+func (s *NAU7802) write(reg, value byte) {
+	switch reg {
+	case device.NAU7802_PU_CTRL:
+		if value&(1<<device.NAU7802_PU_CTRL_RR) != 0 {
+			s.reset()
+			s.regs[reg] = 1 << device.NAU7802_PU_CTRL_RR
+			return
+		}
+
+		old := s.regs[reg]
+		readOnly := byte(1<<device.NAU7802_PU_CTRL_PUR | 1<<device.NAU7802_PU_CTRL_CR)
+		s.regs[reg] = value&^readOnly | old&readOnly
+
+		if s.powered() && !poweredBits(old) {
+			s.powerUpAt = s.Now().Add(s.PowerUpTime)
+		} else if !s.powered() {
+			s.regs[reg] &^= 1 << device.NAU7802_PU_CTRL_CR
+			if !s.StuckPowerDown {
+				s.regs[reg] &^= 1 << device.NAU7802_PU_CTRL_PUR
+			}
+			s.powerUpAt = time.Time{}
+		}
+	case device.NAU7802_CTRL2:
+		old := s.regs[reg]
+		status := byte(1<<device.NAU7802_CTRL2_CALS | 1<<device.NAU7802_CTRL2_CAL_ERROR)
+		s.regs[reg] = value&^status | old&status
+
+		if value&(1<<device.NAU7802_CTRL2_CALS) != 0 && !s.calibrates {
+			s.calibrates = true
+			s.calDoneAt = s.Now().Add(s.CalibrationTime)
+			s.regs[reg] |= 1 << device.NAU7802_CTRL2_CALS
+			s.regs[reg] &^= 1 << device.NAU7802_CTRL2_CAL_ERROR
+		}
+		if (old^value)&0xF0 != 0 {
+			// changing the channel or the sample rate restarts conversion
+			s.restartConversion()
+		}
+	case device.NAU7802_CTRL1:
+		s.regs[reg] = value
+		s.restartConversion()
+	case device.NAU7802_I2C_CONTROL:
+		old := s.regs[reg]
+		s.regs[reg] = value
+		if (old^value)&(1<<device.NAU7802_I2C_CONTROL_TS) != 0 {
+			s.restartConversion()
+		}
+	case device.NAU7802_ADCO_B2, device.NAU7802_ADCO_B1, device.NAU7802_ADCO_B0, device.NAU7802_DEVICE_REV:
+		// read only
+	default:
+		s.regs[reg] = value
+	}
+}
+
+func poweredBits(puCtrl byte) bool {
+	mask := byte(1<<device.NAU7802_PU_CTRL_PUD | 1<<device.NAU7802_PU_CTRL_PUA)
+	return puCtrl&mask == mask
+}
+
+func (s *NAU7802) powered() bool {
+	return poweredBits(s.regs[device.NAU7802_PU_CTRL])
+}
+
+func (s *NAU7802) ready() bool {
+	return s.regs[device.NAU7802_PU_CTRL]&(1<<device.NAU7802_PU_CTRL_PUR) != 0
+}
+
+func (s *NAU7802) restartConversion() {
+	s.convStart = s.Now()
+	s.lastRead = 0
+	s.regs[device.NAU7802_PU_CTRL] &^= 1 << device.NAU7802_PU_CTRL_CR
+}
+
+// update advances the simulated time dependent state: power-up,
+// calibration and the conversion cycle.
+func (s *NAU7802) update() {
+	now := s.Now()
+
+	if s.powered() && !s.ready() && !s.StuckPowerUp && !s.powerUpAt.IsZero() && !now.Before(s.powerUpAt) {
+		s.regs[device.NAU7802_PU_CTRL] |= 1 << device.NAU7802_PU_CTRL_PUR
+		s.restartConversion()
+	}
+
+	if s.calibrates && !s.StuckCalibration && !now.Before(s.calDoneAt) {
+		s.calibrates = false
+		s.regs[device.NAU7802_CTRL2] &^= 1 << device.NAU7802_CTRL2_CALS
+		if s.CalibrationError || !s.finishCalibration() {
+			s.regs[device.NAU7802_CTRL2] |= 1 << device.NAU7802_CTRL2_CAL_ERROR
+		}
+		s.restartConversion()
+	}
+
+	if s.ready() && !s.calibrates && s.conversions(now) > s.lastRead {
+		s.regs[device.NAU7802_PU_CTRL] |= 1 << device.NAU7802_PU_CTRL_CR
+	}
+}
+
+// conversions returns the number of conversions finished since the
+// conversion cycle was (re)started.
+func (s *NAU7802) conversions(now time.Time) int64 {
+	return int64(now.Sub(s.convStart) / s.conversionTime())
+}
+
+// conversionTime returns the time of one conversion at the configured
+// sample rate, reserved rates run at 10 samples per second.
+func (s *NAU7802) conversionTime() time.Duration {
+	rate := int(s.regs[device.NAU7802_CTRL2]>>device.NAU7802_CTRL2_CRS) & 0b111
+	if t := device.ConversionTime(rate); t != 0 {
+		return t
+	}
+	return device.ConversionTime(device.NAU7802_SPS_10)
+}
+
+// latchConversion puts the newest conversion result into ADCO and clears
+// CR, like reading the output registers of the real chip does.
+func (s *NAU7802) latchConversion() {
+	if !s.ready() || s.calibrates {
+		return
+	}
+
+	done := s.conversions(s.Now())
+	if done <= s.lastRead {
+		// no new conversion, ADCO still holds the previous result
+		return
+	}
+	s.lastRead = done
+	s.regs[device.NAU7802_PU_CTRL] &^= 1 << device.NAU7802_PU_CTRL_CR
+
+	channel := s.channel()
+	value := int64(s.raw[channel]) + int64(math.Round(s.Drift*(s.Temperature-25)))
+	if s.regs[device.NAU7802_I2C_CONTROL]&(1<<device.NAU7802_I2C_CONTROL_TS) != 0 {
+		vldo := s.regs[device.NAU7802_CTRL1] >> (device.NAU7802_CTRL1_VLDO - 2) & 0b111
+		value = int64(device.TemperatureCode(s.Temperature, 4.5-0.3*float64(vldo)))
+	}
+	if s.Noise > 0 {
+		value += int64(rand.Int31n(2*s.Noise+1) - s.Noise)
+	}
+	value = (value - int64(s.ocal(channel))) * int64(s.gcal(channel)) / device.NAU7802_GCAL_DEFAULT
+	if value > maxCode {
+		value = maxCode
+	} else if value < minCode {
+		value = minCode
+	}
+
+	s.regs[device.NAU7802_ADCO_B2] = byte(value >> 16)
+	s.regs[device.NAU7802_ADCO_B1] = byte(value >> 8)
+	s.regs[device.NAU7802_ADCO_B0] = byte(value)
+}
+
+func (s *NAU7802) channel() int {
+	return int(s.regs[device.NAU7802_CTRL2]>>device.NAU7802_CTRL2_CHS) & 1
+}
+
+// calibrationRegister returns the first OCAL register of channel, GCAL
+// follows it.
+func calibrationRegister(channel int) byte {
+	if channel == device.NAU7802_CHANNEL_2 {
+		return device.NAU7802_OCAL2_B2
+	}
+	return device.NAU7802_OCAL1_B2
+}
+
+func (s *NAU7802) ocal(channel int) int32 {
+	r := s.regs[calibrationRegister(channel):]
+	return int32(uint32(r[0])<<24|uint32(r[1])<<16|uint32(r[2])<<8) >> 8
+}
+
+func (s *NAU7802) setOCAL(channel int, value int32) {
+	r := s.regs[calibrationRegister(channel):]
+	r[0], r[1], r[2] = byte(value>>16), byte(value>>8), byte(value)
+}
+
+func (s *NAU7802) gcal(channel int) uint32 {
+	r := s.regs[calibrationRegister(channel)+3:]
+	return uint32(r[0])<<24 | uint32(r[1])<<16 | uint32(r[2])<<8 | uint32(r[3])
+}
+
+func (s *NAU7802) setGCAL(channel int, value uint32) {
+	r := s.regs[calibrationRegister(channel)+3:]
+	r[0], r[1], r[2], r[3] = byte(value>>24), byte(value>>16), byte(value>>8), byte(value)
+}
+
+// finishCalibration stores the result of the calibration selected by
+// CALMOD in OCAL or GCAL of the selected channel. The internal calibration
+// of the model has no offset to remove. It reports false if the inputs do
+// not allow a calibration.
+func (s *NAU7802) finishCalibration() bool {
+	channel := s.channel()
+
+	switch s.regs[device.NAU7802_CTRL2] & 0b11 {
+	case device.NAU7802_CALMOD_OFFSET:
+		s.setOCAL(channel, s.raw[channel])
+	case device.NAU7802_CALMOD_GAIN:
+		span := int64(s.raw[channel]) - int64(s.ocal(channel))
+		if span <= 0 {
+			return false
+		}
+		gain := int64(device.NAU7802_GCAL_DEFAULT) * maxCode / span
+		if gain > math.MaxUint32 {
+			return false
+		}
+		s.setGCAL(channel, uint32(gain))
+	}
+
+	return true
+}
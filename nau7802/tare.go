@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/SimonWaldherr/rpi-examples/scale"
+)
+
+const tareHelp = `t          tare the weight on the scale
+p WEIGHT   preset the tare
+c          clear the tare
+r NAME     recall a stored tare
+s NAME     store the tare
+d NAME     delete a stored tare
+l          list the stored tares`
+
+// printReading prints net, gross and tare of a reading of run.
+func printReading(r scale.Reading, t *scale.Tared) {
+	state := ""
+	if r.Stable {
+		state = " stable"
+	}
+	tare := fmt.Sprint(r.Tare)
+	if _, name := t.GetTare(); name != "" {
+		tare += " (" + name + ")"
+	}
+	fmt.Printf("net %v\tgross %v\ttare %s%s\n", r.Net, r.Gross, tare, state)
+}
+
+// tareCommands reads the commands of tareHelp, one per line, while run
+// prints the weights.
+func tareCommands(t *scale.Tared, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if err := tareCommand(t, fields[0], fields[1:]); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+func tareCommand(t *scale.Tared, command string, args []string) error {
+	arg := func() (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("%s needs one argument", command)
+		}
+		return args[0], nil
+	}
+
+	switch command {
+	case "t":
+		return t.PushTare()
+	case "c":
+		t.ClearTare()
+		return nil
+	case "l":
+		for _, name := range t.Memory.Names() {
+			fmt.Printf("%s\t%v\n", name, t.Memory[name])
+		}
+		return nil
+	case "p":
+		value, err := arg()
+		if err != nil {
+			return err
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		return t.PresetTare(weight)
+	case "r", "s", "d":
+		name, err := arg()
+		if err != nil {
+			return err
+		}
+		switch command {
+		case "r":
+			return t.RecallTare(name)
+		case "s":
+			return t.StoreTare(name)
+		}
+		return t.DeleteTare(name)
+	}
+
+	fmt.Println(tareHelp)
+	return nil
+}
@@ -1,16 +1,16 @@
 package main
 
 import (
+	"flag"
 	"os"
 	"time"
 
+	"github.com/SimonWaldherr/rpi-examples/i2cconf"
 	"github.com/op/go-logging"
 	"github.com/sergiorb/pca9685-golang/device"
-	"golang.org/x/exp/io/i2c"
 )
 
 const (
-	I2C_ADDR      = "/dev/i2c-1"
 	ADDR_01       = 0x40
 	SERVO_CHANNEL = 4
 	MIN_PULSE     = 150
@@ -36,8 +36,16 @@ func main() {
 
 	var mainLog = logging.MustGetLogger("PCA9685 Demo")
 
-	i2cDevice, err := i2c.Open(&i2c.Devfs{Dev: I2C_ADDR}, ADDR_01)
-	defer i2cDevice.Close()
+	bus := i2cconf.NewOptions(flag.CommandLine)
+	pwm := bus.Add("pca9685", "addr", i2cconf.PCA9685, ADDR_01)
+	flag.Parse()
+
+	if err := bus.Resolve(); err != nil {
+		mainLog.Error(err)
+		os.Exit(2)
+	}
+
+	i2cDevice, err := pwm.Open()
 
 	if err != nil {
 
@@ -45,6 +53,8 @@ func main() {
 
 	} else {
 
+		defer i2cDevice.Close()
+
 		var deviceLog = logging.MustGetLogger("PCA9685")
 
 		pca9685 := device.NewPCA9685(i2cDevice, "PWM Controller", MIN_PULSE, MAX_PULSE, deviceLog)
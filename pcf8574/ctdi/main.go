@@ -1,17 +1,16 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log"
 	"time"
 
+	"github.com/SimonWaldherr/rpi-examples/i2cconf"
 	"golang.org/x/exp/io/i2c"
 	"simonwaldherr.de/go/golibs/bitmask"
 )
 
-const (
-	I2C_ADDR = "/dev/i2c-1"
-)
-
 var pins map[int]int
 var i2cDev1, i2cDev2 *i2c.Device
 var bm1, bm2 *bitmask.Bitmask
@@ -56,15 +55,18 @@ func init() {
 		11: 12,
 		12: 13,
 	}
-	
+}
+
+// open opens both PCF8574 and switches all relays off.
+func open(dev1, dev2 i2cconf.Device) {
 	var err error
-	i2cDev1, err = i2c.Open(&i2c.Devfs{Dev: I2C_ADDR}, 0x20)
+	i2cDev1, err = dev1.Open()
 	if err != nil {
 		panic(err)
 	}
 	
 	
-	i2cDev2, err = i2c.Open(&i2c.Devfs{Dev: I2C_ADDR}, 0x21)
+	i2cDev2, err = dev2.Open()
 	if err != nil {
 		panic(err)
 	}
@@ -79,6 +81,19 @@ func init() {
 }
 
 func main() {
+	bus := i2cconf.NewOptions(flag.CommandLine)
+	valves := bus.Add("valves", "addr1", i2cconf.PCF8574, 0x20)
+	pump := bus.Add("pump", "addr2", i2cconf.PCF8574, 0x21)
+	flag.Parse()
+
+	if err := bus.Resolve(); err != nil {
+		log.Fatal(err)
+	}
+	if valves.Device == pump.Device {
+		log.Fatalf("both PCF8574 are configured as %s", valves.Device)
+	}
+
+	open(valves.Device, pump.Device)
 	defer i2cDev1.Close()
 	defer i2cDev2.Close()
 	
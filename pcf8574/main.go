@@ -1,21 +1,29 @@
 package main
 
 import (
-	"fmt"
+	"flag"
+	"log"
 	"strconv"
 	"time"
 
-	"golang.org/x/exp/io/i2c"
+	"github.com/SimonWaldherr/rpi-examples/i2cconf"
 	"simonwaldherr.de/go/golibs/bitmask"
 )
 
 const (
-	I2C_ADDR = "/dev/i2c-1"
-	ADDR_01  = 0x20
+	ADDR_01 = 0x20
 )
 
 func main() {
-	i2cDevice, err := i2c.Open(&i2c.Devfs{Dev: I2C_ADDR}, ADDR_01)
+	bus := i2cconf.NewOptions(flag.CommandLine)
+	pcf8574 := bus.Add("pcf8574", "addr", i2cconf.PCF8574, ADDR_01)
+	flag.Parse()
+
+	if err := bus.Resolve(); err != nil {
+		log.Fatal(err)
+	}
+
+	i2cDevice, err := pcf8574.Open()
 	if err != nil {
 		panic(err)
 	}
@@ -38,13 +46,4 @@ func main() {
 		}
 		time.Sleep(1500 * time.Millisecond)
 	}
-
-	for i := 0; i < 8; i++ {
-		bitmask.Set(i, false)
-		i2cDevice.Write([]byte{byte(bitmask.Int())})
-		fmt.Println(bitmask)
-		fmt.Printf("%b\n", []byte{byte(bitmask.Int())})
-		bitmask.Set(i, true)
-		time.Sleep(8000 * time.Millisecond)
-	}
 }
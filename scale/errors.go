@@ -0,0 +1,142 @@
+package scale
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Classes of read errors, test for them with errors.Is.
+var (
+	// ErrNotReady is a timeout waiting for a conversion.
+	ErrNotReady = errors.New("scale: data not ready")
+
+	// ErrIO is a failure of the GPIO pins of the HX711 or of the I2C bus
+	// of the NAU7802.
+	ErrIO = errors.New("scale: adc i/o failure")
+
+	// ErrImplausible is a reading the load cell cannot have produced,
+	// e.g. a saturated ADC.
+	ErrImplausible = errors.New("scale: implausible reading")
+)
+
+// ReadError is a failed read of one of the classes above, the error of the
+// driver is kept.
+type ReadError struct {
+	Class error
+	Err   error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Class, e.Err)
+}
+
+func (e *ReadError) Is(target error) bool {
+	return target == e.Class
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// Limits of the 24-bit output of the HX711, it saturates there.
+const (
+	hx711Max = 1<<23 - 1
+	hx711Min = -1 << 23
+)
+
+// hx711Error classifies the error of a read of hx711go by the time the
+// read took. The driver has no error values of its own, but it only fails
+// late when it gave up waiting for the chip: a read that failed after
+// timeout or later was not ready, a faster one failed on the GPIO pins.
+func hx711Error(err error, took, timeout time.Duration) error {
+	switch {
+	case err == nil:
+		return nil
+	case took >= timeout:
+		return &ReadError{Class: ErrNotReady, Err: err}
+	}
+	return &ReadError{Class: ErrIO, Err: err}
+}
+
+// timedRead runs a read of hx711go and classifies its error with
+// hx711Error.
+func timedRead(read func() (int, error), timeout time.Duration) (int, error) {
+	start := time.Now()
+	raw, err := read()
+	return raw, hx711Error(err, time.Since(start), timeout)
+}
+
+// hx711Check rejects saturated and out of range readings.
+func hx711Check(raw int) error {
+	if raw <= hx711Min || raw >= hx711Max {
+		return &ReadError{Class: ErrImplausible, Err: fmt.Errorf("raw value %d at the limit of the adc", raw)}
+	}
+	return nil
+}
+
+// ErrorCounts counts reads and failed reads by class.
+type ErrorCounts struct {
+	Reads       uint64
+	NotReady    uint64
+	IO          uint64
+	Implausible uint64
+}
+
+// Errors returns the number of failed reads.
+func (c ErrorCounts) Errors() uint64 {
+	return c.NotReady + c.IO + c.Implausible
+}
+
+// Rate returns the share of failed reads, 0 without reads.
+func (c ErrorCounts) Rate() float64 {
+	if c.Reads == 0 {
+		return 0
+	}
+	return float64(c.Errors()) / float64(c.Reads)
+}
+
+func (c ErrorCounts) String() string {
+	return fmt.Sprintf("%d reads, %d not ready, %d i/o, %d implausible (%.1f%% failed)",
+		c.Reads, c.NotReady, c.IO, c.Implausible, 100*c.Rate())
+}
+
+// counter keeps the ErrorCounts of an adapter, it is shared by Stream and
+// the caller.
+type counter struct {
+	mu     sync.Mutex
+	counts ErrorCounts
+}
+
+// count records a read and returns err.
+func (c *counter) count(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts.Reads++
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotReady):
+		c.counts.NotReady++
+	case errors.Is(err, ErrImplausible):
+		c.counts.Implausible++
+	default:
+		c.counts.IO++
+	}
+	return err
+}
+
+func (c *counter) GetErrorCounts() ErrorCounts {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.counts
+}
+
+func (c *counter) ResetErrorCounts() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.counts = ErrorCounts{}
+}
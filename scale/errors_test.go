@@ -0,0 +1,84 @@
+package scale
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHX711Error(t *testing.T) {
+	failed := errors.New("waitForDataReady error: timeout")
+
+	tests := []struct {
+		name  string
+		err   error
+		took  time.Duration
+		class error
+	}{
+		{"success", nil, time.Second, nil},
+		{"gave up waiting", failed, time.Second, ErrNotReady},
+		{"at the timeout", failed, hx711ReadyTimeout, ErrNotReady},
+		{"just before the timeout", failed, hx711ReadyTimeout - time.Nanosecond, ErrIO},
+		{"gpio", errors.New("clockPin.Out High error"), time.Millisecond, ErrIO},
+		{"fast, whatever the message", failed, time.Millisecond, ErrIO},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := hx711Error(tt.err, tt.took, hx711ReadyTimeout)
+			if tt.class == nil {
+				if err != nil {
+					t.Fatalf("got %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.class) {
+				t.Errorf("got %v, want class %v", err, tt.class)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%v does not wrap the error of the driver", err)
+			}
+		})
+	}
+}
+
+// TestTimedRead fails reads of a fake hx711go that take the time it waits
+// for the chip, around the ReadyTimeout.
+func TestTimedRead(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	failed := errors.New("waitForDataReady error: timeout")
+
+	tests := []struct {
+		name  string
+		wait  time.Duration
+		err   error
+		class error
+	}{
+		{"success after waiting", timeout, nil, nil},
+		{"gave up at the timeout", timeout, failed, ErrNotReady},
+		{"gave up after the timeout", 2 * timeout, failed, ErrNotReady},
+		{"failed before the timeout", timeout / 5, failed, ErrIO},
+		{"failed at once", 0, failed, ErrIO},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := timedRead(func() (int, error) {
+				time.Sleep(tt.wait)
+				return 42, tt.err
+			}, timeout)
+			if raw != 42 {
+				t.Errorf("raw %d, want 42", raw)
+			}
+			if tt.class == nil {
+				if err != nil {
+					t.Errorf("got %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.class) {
+				t.Errorf("got %v, want class %v", err, tt.class)
+			}
+		})
+	}
+}
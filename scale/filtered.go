@@ -0,0 +1,82 @@
+package scale
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SimonWaldherr/rpi-examples/filter"
+)
+
+// Filtered runs the weights of the stream of a scale through a filter
+// chain. ReadRaw and ReadWeight already combine several conversions and
+// are passed through. Values dropped by the outlier rejection are sent as
+// readings with an ErrImplausible error.
+type Filtered struct {
+	Scale
+	Chain filter.Chain
+}
+
+// NewFiltered returns s with chain applied, s itself for an empty chain.
+func NewFiltered(s Scale, chain filter.Chain) Scale {
+	if len(chain) == 0 {
+		return s
+	}
+	return &Filtered{Scale: s, Chain: chain}
+}
+
+// Unwrap returns the adapter of the ADC below any filters, monitors, tares
+// and recorders.
+func Unwrap(s Scale) Scale {
+	for {
+		switch w := s.(type) {
+		case *Filtered:
+			s = w.Scale
+		case *Monitored:
+			s = w.Scale
+		case *Tared:
+			s = w.Scale
+		case *Recorder:
+			s = w.Scale
+		default:
+			return s
+		}
+	}
+}
+
+// Stream starts with fresh filters, so the weights of an earlier stream
+// do not leak into it. Every channel gets a chain of its own.
+func (f *Filtered) Stream(ctx context.Context) <-chan Reading {
+	ch := make(chan Reading, 16)
+	readings := f.Scale.Stream(ctx)
+	chains := make(map[int]filter.Chain)
+
+	go func() {
+		defer close(ch)
+
+		for r := range readings {
+			chain, ok := chains[r.Channel]
+			if !ok {
+				// the chain parsed before, so does its description
+				chain, _ = filter.Parse(f.Chain.String())
+				chains[r.Channel] = chain
+			}
+
+			if r.Err == nil {
+				weight, ok := chain.Next(r.Weight)
+				if ok {
+					r.Weight = weight
+				} else {
+					r.Err = &ReadError{Class: ErrImplausible, Err: fmt.Errorf("%w: %v", filter.ErrOutlier, r.Weight)}
+				}
+			}
+
+			select {
+			case ch <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
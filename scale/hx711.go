@@ -0,0 +1,327 @@
+package scale
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/SimonWaldherr/hx711go"
+)
+
+// Gains of the HX711, the gain also selects the input channel.
+const (
+	HX711_GAIN_A128 = 128
+	HX711_GAIN_A64  = 64
+	HX711_GAIN_B32  = 32
+)
+
+// Channels of the HX711 as reported in Reading.Channel.
+const (
+	HX711_CHANNEL_A = 0
+	HX711_CHANNEL_B = 1
+)
+
+// HX711Channel returns the channel selected by gain.
+func HX711Channel(gain int) (int, error) {
+	switch gain {
+	case HX711_GAIN_A128, HX711_GAIN_A64:
+		return HX711_CHANNEL_A, nil
+	case HX711_GAIN_B32:
+		return HX711_CHANNEL_B, nil
+	}
+	return 0, fmt.Errorf("scale: invalid hx711 gain %d, use 128 or 64 for channel A or 32 for channel B", gain)
+}
+
+// hx711ReadyTimeout is the default ReadyTimeout. hx711go waits about a
+// second for the chip, a conversion takes 100ms at 10 SPS.
+const hx711ReadyTimeout = 500 * time.Millisecond
+
+// HX711 is the Scale of an HX711. The gain of a conversion is selected by
+// the clock pulses after the previous one, so the driver keeps track of
+// the gain of the conversion in progress and discards it if it does not
+// match.
+type HX711 struct {
+	Dev *hx711.Hx711
+
+	// ReadyTimeout tells a read that failed waiting for the chip from a
+	// failure of the GPIO pins: a failed read that took at least this long
+	// is ErrNotReady, a faster one ErrIO. It has to be longer than a
+	// conversion and shorter than the wait of hx711go. If a new version of
+	// hx711go waits less than ReadyTimeout, every read that is not ready
+	// counts as ErrIO: lower ReadyTimeout below that wait, and keep it
+	// above 100ms, the conversion time at 10 SPS.
+	ReadyTimeout time.Duration
+
+	cal  Calibration
+	gain int
+
+	// second is the calibration of channel B if both channels are read
+	second *Calibration
+
+	// pending is the gain of the conversion the next read returns, 0 if
+	// unknown
+	pending int
+
+	counter
+}
+
+// NewHX711 initializes the host and opens the HX711 on the clock and data
+// pins, e.g. "6" and "5". It starts on channel A with a gain of 128.
+func NewHX711(clockPin, dataPin string) (*HX711, error) {
+	if err := hx711.HostInit(); err != nil {
+		return nil, err
+	}
+
+	dev, err := hx711.NewHx711(clockPin, dataPin)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &HX711{Dev: dev, ReadyTimeout: hx711ReadyTimeout, gain: HX711_GAIN_A128}
+	h.SetCalibration(Calibration{Factor: 1})
+	return h, nil
+}
+
+// SetGain selects the gain and with it the channel read by the Scale
+// methods.
+func (h *HX711) SetGain(gain int) error {
+	if _, err := HX711Channel(gain); err != nil {
+		return err
+	}
+	h.gain = gain
+	return nil
+}
+
+func (h *HX711) GetGain() int {
+	return h.gain
+}
+
+// SetSecondChannel makes Stream alternate between channel A and channel B
+// for a second load cell on B, which is converted with c. nil reads the
+// selected channel only. The gain must select channel A.
+func (h *HX711) SetSecondChannel(c *Calibration) error {
+	if c != nil {
+		if channel, _ := HX711Channel(h.gain); channel != HX711_CHANNEL_A {
+			return fmt.Errorf("scale: the second hx711 channel needs a gain of 128 or 64 on channel A")
+		}
+		if err := c.Validate(); err != nil {
+			return err
+		}
+	}
+	h.second = c
+	return nil
+}
+
+// GetSecondChannel returns the calibration of channel B, nil if only the
+// selected channel is read.
+func (h *HX711) GetSecondChannel() *Calibration {
+	return h.second
+}
+
+// Dual reports whether both channels are read.
+func (h *HX711) Dual() bool {
+	return h.second != nil
+}
+
+// selectGain makes sure the conversion in progress has gain.
+func (h *HX711) selectGain(gain int) error {
+	if h.pending == gain {
+		return nil
+	}
+
+	h.Dev.SetGain(gain)
+	if _, err := h.conversion(); err != nil {
+		h.pending = 0
+		return h.count(err)
+	}
+	h.pending = gain
+	return nil
+}
+
+// conversion reads a conversion of the driver and classifies its error by
+// the time the read took.
+func (h *HX711) conversion() (int, error) {
+	return timedRead(h.Dev.ReadDataRaw, h.ReadyTimeout)
+}
+
+// checked rejects implausible readings and counts the read.
+func (h *HX711) checked(raw int, err error) (int, error) {
+	if err == nil {
+		err = hx711Check(raw)
+	}
+	return raw, h.count(err)
+}
+
+// read returns one conversion at gain and starts the next one at next.
+func (h *HX711) read(gain, next int) (int, error) {
+	if err := h.selectGain(gain); err != nil {
+		return 0, err
+	}
+
+	h.Dev.SetGain(next)
+	raw, err := h.checked(h.conversion())
+	if err != nil {
+		h.pending = 0
+		return 0, err
+	}
+	h.pending = next
+	return raw, nil
+}
+
+func (h *HX711) ReadRaw(samples int) (int, error) {
+	if samples < 1 {
+		return 0, ErrInvalidSampleCount
+	}
+
+	if err := h.selectGain(h.gain); err != nil {
+		return 0, err
+	}
+
+	// every conversion is read on its own so its error can be classified
+	readings := make([]int, samples)
+	for i := range readings {
+		raw, err := h.conversion()
+		if err != nil {
+			h.pending = 0
+			return 0, h.count(err)
+		}
+		readings[i] = raw
+	}
+	return h.checked(median(readings), nil)
+}
+
+// ReadChannels returns the median of samples conversions of channel A at
+// the selected gain and of channel B, the channels are converted
+// alternately.
+func (h *HX711) ReadChannels(samples int) (a, b int, err error) {
+	if samples < 1 {
+		return 0, 0, ErrInvalidSampleCount
+	}
+
+	gainA := h.gain
+	if channel, _ := HX711Channel(gainA); channel != HX711_CHANNEL_A {
+		gainA = HX711_GAIN_A128
+	}
+
+	readingsA := make([]int, samples)
+	readingsB := make([]int, samples)
+	for i := 0; i < samples; i++ {
+		if readingsA[i], err = h.read(gainA, HX711_GAIN_B32); err != nil {
+			return 0, 0, err
+		}
+		if readingsB[i], err = h.read(HX711_GAIN_B32, gainA); err != nil {
+			return 0, 0, err
+		}
+	}
+	return median(readingsA), median(readingsB), nil
+}
+
+func (h *HX711) ReadWeight(samples int) (float64, error) {
+	raw, err := h.ReadRaw(samples)
+	if err != nil {
+		return 0, err
+	}
+	return h.cal.Weight(raw), nil
+}
+
+func (h *HX711) Tare(samples int) error {
+	raw, err := h.ReadRaw(samples)
+	if err != nil {
+		return err
+	}
+
+	h.cal.Zero = raw
+	h.Dev.AdjustZero = raw
+	return nil
+}
+
+func (h *HX711) Calibrate(knownWeight float64, samples int) error {
+	raw, err := h.ReadRaw(samples)
+	if err != nil {
+		return err
+	}
+
+	f, err := factor(raw, h.cal.Zero, knownWeight)
+	if err != nil {
+		return err
+	}
+	return h.SetCalibration(Calibration{Zero: h.cal.Zero, Factor: f})
+}
+
+func (h *HX711) GetCalibration() Calibration {
+	return h.cal
+}
+
+// SetCalibration also sets AdjustZero and AdjustScale of the driver, so its
+// own weight readings agree as long as no curve is used.
+func (h *HX711) SetCalibration(c Calibration) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	h.cal = c
+	h.Dev.AdjustZero = c.Zero
+	h.Dev.AdjustScale = c.Factor
+	return nil
+}
+
+// hx711RetryDelay is the pause after a failed conversion, the driver
+// already waited for the chip.
+const hx711RetryDelay = 10 * time.Millisecond
+
+// Stream sends the conversions of the selected channel, with a second
+// channel it alternates between channel A and B.
+func (h *HX711) Stream(ctx context.Context) <-chan Reading {
+	ch := make(chan Reading, 16)
+
+	go func() {
+		defer close(ch)
+
+		channel, _ := HX711Channel(h.gain)
+		for ctx.Err() == nil {
+			gain, next, cal := h.gain, h.gain, h.cal
+			if h.second != nil {
+				next = HX711_GAIN_B32
+				if channel == HX711_CHANNEL_B {
+					gain, next, cal = HX711_GAIN_B32, h.gain, *h.second
+				}
+			}
+
+			raw, err := h.read(gain, next)
+			r := Reading{Time: time.Now(), Channel: channel, Raw: raw, Err: err}
+			if err == nil {
+				r.Weight = cal.Weight(raw)
+				if h.second != nil {
+					channel = 1 - channel
+				}
+			}
+
+			select {
+			case ch <- r:
+			case <-ctx.Done():
+				return
+			}
+
+			if err != nil {
+				select {
+				case <-time.After(hx711RetryDelay):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch
+}
+
+// median returns the median of readings, which it sorts.
+func median(readings []int) int {
+	sort.Ints(readings)
+	return readings[len(readings)/2]
+}
+
+func (h *HX711) Close() error {
+	return h.Dev.Shutdown()
+}
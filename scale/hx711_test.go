@@ -0,0 +1,83 @@
+package scale
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHX711Channel(t *testing.T) {
+	tests := []struct {
+		gain    int
+		channel int
+		valid   bool
+	}{
+		{HX711_GAIN_A128, HX711_CHANNEL_A, true},
+		{HX711_GAIN_A64, HX711_CHANNEL_A, true},
+		{HX711_GAIN_B32, HX711_CHANNEL_B, true},
+		{0, 0, false},
+		{1, 0, false},
+		{16, 0, false},
+		{-128, 0, false},
+		{256, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.gain), func(t *testing.T) {
+			channel, err := HX711Channel(tt.gain)
+			if !tt.valid {
+				if err == nil {
+					t.Errorf("got channel %d, want an error", channel)
+				}
+				return
+			}
+			if err != nil || channel != tt.channel {
+				t.Errorf("got channel %d, %v, want %d", channel, err, tt.channel)
+			}
+		})
+	}
+
+	h := &HX711{gain: HX711_GAIN_A64}
+	if err := h.SetGain(16); err == nil {
+		t.Error("SetGain(16) succeeded")
+	}
+	if h.GetGain() != HX711_GAIN_A64 {
+		t.Errorf("gain %d after an invalid gain, want 64", h.GetGain())
+	}
+}
+
+func TestSetSecondChannel(t *testing.T) {
+	tests := []struct {
+		name  string
+		gain  int
+		cal   *Calibration
+		valid bool
+	}{
+		{"gain 128", HX711_GAIN_A128, &Calibration{Factor: 2}, true},
+		{"gain 64", HX711_GAIN_A64, &Calibration{Factor: 2}, true},
+		{"gain 32 selects channel B", HX711_GAIN_B32, &Calibration{Factor: 2}, false},
+		{"invalid calibration", HX711_GAIN_A128, &Calibration{}, false},
+		{"off on channel B", HX711_GAIN_B32, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &HX711{gain: tt.gain}
+			err := h.SetSecondChannel(tt.cal)
+			if !tt.valid {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				if h.Dual() {
+					t.Error("both channels read after an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.GetSecondChannel() != tt.cal || h.Dual() != (tt.cal != nil) {
+				t.Errorf("second channel %v, dual %v, want %v", h.GetSecondChannel(), h.Dual(), tt.cal)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package scale
+
+import (
+	"context"
+	"flag"
+	"math"
+	"sync"
+	"time"
+)
+
+// Stability flags a weight stable once the last Window weights lie within
+// Tolerance of each other.
+type Stability struct {
+	Window    int
+	Tolerance float64
+
+	weights []float64
+}
+
+// Next adds a weight and tells whether the scale is at rest.
+func (s *Stability) Next(weight float64) bool {
+	if s.Window < 1 {
+		return false
+	}
+	if s.weights = append(s.weights, weight); len(s.weights) > s.Window {
+		s.weights = s.weights[1:]
+	}
+	if len(s.weights) < s.Window {
+		return false
+	}
+
+	lo, hi := s.weights[0], s.weights[0]
+	for _, w := range s.weights {
+		lo, hi = math.Min(lo, w), math.Max(hi, w)
+	}
+	return hi-lo <= s.Tolerance
+}
+
+func (s *Stability) Reset() {
+	s.weights = nil
+}
+
+// ZeroTracking follows a slow drift of the zero. While the scale is stable
+// and the corrected weight lies within Band of zero the offset moves
+// towards the weight by at most Rate units per second, so a load put on
+// the scale is not tracked away. Initial zeroes the first stable weight
+// within that range, e.g. an empty platform at start-up. A Band or
+// Initial of 0 disables that part.
+type ZeroTracking struct {
+	Band    float64
+	Rate    float64
+	Initial float64
+
+	// Offset is subtracted from the weights.
+	Offset float64
+
+	last   time.Time
+	zeroed bool
+}
+
+// Next returns the weight at t with the offset subtracted and updates the
+// offset.
+func (z *ZeroTracking) Next(t time.Time, weight float64, stable bool) float64 {
+	last := z.last
+	z.last = t
+
+	if !stable {
+		return weight - z.Offset
+	}
+
+	switch {
+	case !z.zeroed:
+		z.zeroed = true
+		if z.Initial > 0 && math.Abs(weight) <= z.Initial {
+			z.Offset = weight
+		}
+	case z.Band > 0 && !last.IsZero() && math.Abs(weight-z.Offset) <= z.Band:
+		step := z.Rate * t.Sub(last).Seconds()
+		z.Offset += math.Max(-step, math.Min(step, weight-z.Offset))
+	}
+
+	return weight - z.Offset
+}
+
+// Reset drops the offset, after a tare the zero is known again.
+func (z *ZeroTracking) Reset() {
+	z.Offset, z.last, z.zeroed = 0, time.Time{}, true
+}
+
+// Monitored adds stability detection and zero tracking to the stream of
+// a scale, see Reading.Stable and Reading.ZeroOffset. Like Filtered it
+// leaves ReadRaw and ReadWeight alone. Every channel is tracked on its own.
+type Monitored struct {
+	Scale
+	Stability Stability
+	Zero      ZeroTracking
+
+	mu    sync.Mutex
+	zeros map[int]*ZeroTracking
+}
+
+// NewMonitored returns s with stability detection and zero tracking, s
+// itself if stability detection is off, zero tracking depends on it.
+func NewMonitored(s Scale, stability Stability, zero ZeroTracking) Scale {
+	if stability.Window < 1 {
+		return s
+	}
+	return &Monitored{Scale: s, Stability: stability, Zero: zero, zeros: make(map[int]*ZeroTracking)}
+}
+
+// GetZeroOffset returns the correction of the zero tracking of channel.
+func (m *Monitored) GetZeroOffset(channel int) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if z, ok := m.zeros[channel]; ok {
+		return z.Offset
+	}
+	return 0
+}
+
+// reset drops the tracked offsets after the zero was set.
+func (m *Monitored) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, z := range m.zeros {
+		z.Reset()
+	}
+}
+
+func (m *Monitored) Tare(samples int) error {
+	err := m.Scale.Tare(samples)
+	if err == nil {
+		m.reset()
+	}
+	return err
+}
+
+func (m *Monitored) SetCalibration(c Calibration) error {
+	err := m.Scale.SetCalibration(c)
+	if err == nil {
+		m.reset()
+	}
+	return err
+}
+
+// Stream starts the stability detection over, the tracked zero offsets are
+// kept from earlier streams.
+func (m *Monitored) Stream(ctx context.Context) <-chan Reading {
+	ch := make(chan Reading, 16)
+	readings := m.Scale.Stream(ctx)
+	stability := make(map[int]*Stability)
+
+	go func() {
+		defer close(ch)
+
+		for r := range readings {
+			if r.Err == nil {
+				s, ok := stability[r.Channel]
+				if !ok {
+					s = &Stability{Window: m.Stability.Window, Tolerance: m.Stability.Tolerance}
+					stability[r.Channel] = s
+				}
+				r.Stable = s.Next(r.Weight)
+
+				m.mu.Lock()
+				z, ok := m.zeros[r.Channel]
+				if !ok {
+					z = &ZeroTracking{Band: m.Zero.Band, Rate: m.Zero.Rate, Initial: m.Zero.Initial}
+					m.zeros[r.Channel] = z
+				}
+				r.Weight = z.Next(r.Time, r.Weight, r.Stable)
+				r.ZeroOffset = z.Offset
+				m.mu.Unlock()
+			}
+
+			select {
+			case ch <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// MonitorOptions are the flags of the stability detection and the zero
+// tracking.
+type MonitorOptions struct {
+	Stability Stability
+	Zero      ZeroTracking
+}
+
+// NewMonitorOptions registers -stable-window, -stable-tolerance,
+// -zero-band, -zero-rate and -zero-initial on fs with the given defaults.
+func NewMonitorOptions(fs *flag.FlagSet, stability Stability, zero ZeroTracking) *MonitorOptions {
+	m := &MonitorOptions{Stability: stability, Zero: zero}
+	fs.IntVar(&m.Stability.Window, "stable-window", stability.Window, "readings that must agree for a stable weight, 0 disables stability detection and zero tracking")
+	fs.Float64Var(&m.Stability.Tolerance, "stable-tolerance", stability.Tolerance, "spread of a stable weight")
+	fs.Float64Var(&m.Zero.Band, "zero-band", zero.Band, "stable weights this close to zero are tracked as zero drift, 0 disables zero tracking")
+	fs.Float64Var(&m.Zero.Rate, "zero-rate", zero.Rate, "maximum zero tracking correction per second")
+	fs.Float64Var(&m.Zero.Initial, "zero-initial", zero.Initial, "the first stable weight within this range becomes zero, 0 disables it")
+	return m
+}
+
+// Wrap returns s with the stability detection and zero tracking of the
+// flags.
+func (m *MonitorOptions) Wrap(s Scale) Scale {
+	return NewMonitored(s, m.Stability, m.Zero)
+}
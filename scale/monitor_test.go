@@ -0,0 +1,132 @@
+package scale
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStability(t *testing.T) {
+	s := Stability{Window: 3, Tolerance: 1}
+
+	tests := []struct {
+		weight float64
+		stable bool
+	}{
+		{0, false},
+		{0.5, false},
+		{0.8, true},
+		{1.0, true},
+		{2.1, false},
+		{1.5, false},
+		{1.8, true},
+	}
+	for i, tt := range tests {
+		if got := s.Next(tt.weight); got != tt.stable {
+			t.Errorf("weight %d (%v): stable %v, want %v", i, tt.weight, got, tt.stable)
+		}
+	}
+
+	s.Reset()
+	if s.Next(1.8) {
+		t.Error("stable right after Reset")
+	}
+
+	off := Stability{Tolerance: 1}
+	for i := 0; i < 5; i++ {
+		if off.Next(0) {
+			t.Fatal("stable with a window of 0")
+		}
+	}
+}
+
+func TestZeroTracking(t *testing.T) {
+	start := time.Now()
+	at := func(seconds float64) time.Time {
+		return start.Add(time.Duration(seconds * float64(time.Second)))
+	}
+
+	type step struct {
+		seconds float64
+		weight  float64
+		stable  bool
+		want    float64 // weight with the offset subtracted
+	}
+
+	tests := []struct {
+		name  string
+		zero  ZeroTracking
+		steps []step
+	}{
+		{"in band", ZeroTracking{Band: 1, Rate: 0.5}, []step{
+			{0, 0, true, 0},
+			{1, 0.2, true, 0},
+			{2, 0.4, true, 0},
+		}},
+		{"rate limit", ZeroTracking{Band: 1, Rate: 0.5}, []step{
+			{0, 0, true, 0},
+			{1, 0.9, true, 0.4},
+			{1.5, 0.9, true, 0.15},
+			{2, 0.9, true, 0},
+		}},
+		{"out of band", ZeroTracking{Band: 1, Rate: 0.5}, []step{
+			{0, 0, true, 0},
+			{1, 5, true, 5},
+			{10, 5, true, 5},
+		}},
+		{"moving", ZeroTracking{Band: 1, Rate: 0.5}, []step{
+			{0, 0, true, 0},
+			{1, 0.5, false, 0.5},
+			{2, 0.5, false, 0.5},
+		}},
+		{"band of 0", ZeroTracking{Rate: 0.5}, []step{
+			{0, 0, true, 0},
+			{1, 0.5, true, 0.5},
+		}},
+		{"initial zero", ZeroTracking{Rate: 0.5, Initial: 1000}, []step{
+			{0, 300, false, 300},
+			{1, 300, true, 0},
+			{2, 400, true, 100},
+		}},
+		{"initial zero out of range", ZeroTracking{Rate: 0.5, Initial: 100}, []step{
+			{0, 300, true, 300},
+			{1, 50, true, 50},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := tt.zero
+			for i, s := range tt.steps {
+				if got := z.Next(at(s.seconds), s.weight, s.stable); math.Abs(got-s.want) > 1e-9 {
+					t.Errorf("step %d: got %v, want %v", i, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestZeroTrackingReset(t *testing.T) {
+	now := time.Now()
+
+	z := ZeroTracking{Band: 1, Rate: 0.5, Initial: 1000}
+	z.Next(now, 300, true)
+	if z.Offset != 300 {
+		t.Fatalf("initial offset %v, want 300", z.Offset)
+	}
+
+	z.Reset()
+	// the tare set the zero, the initial zeroing is not repeated
+	if got := z.Next(now.Add(time.Second), 250, true); got != 250 {
+		t.Errorf("got %v after Reset, want 250", got)
+	}
+
+	m := NewMonitored(&compensated{cal: Calibration{Factor: 1}}, Stability{Window: 3, Tolerance: 1}, z).(*Monitored)
+	m.zeros[0] = &ZeroTracking{Band: 1, Offset: 0.7}
+	if err := m.Tare(1); err != nil {
+		t.Fatal(err)
+	}
+	if offset := m.GetZeroOffset(0); offset != 0 {
+		t.Errorf("zero offset %v after Tare, want 0", offset)
+	}
+}
@@ -0,0 +1,128 @@
+package scale
+
+import (
+	"context"
+	"errors"
+
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+)
+
+// NAU7802 is the Scale of the selected channel of a NAU7802. The driver
+// keeps the calibration, including the temperature compensation of the
+// profile.
+type NAU7802 struct {
+	Dev *device.NAU7802
+
+	counter
+}
+
+// NewNAU7802 wraps an initialized driver.
+func NewNAU7802(dev *device.NAU7802) *NAU7802 {
+	return &NAU7802{Dev: dev}
+}
+
+// nau7802Error classifies an error of the driver.
+func nau7802Error(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, device.ErrTimeout):
+		return &ReadError{Class: ErrNotReady, Err: err}
+	case errors.Is(err, device.ErrOverRange), errors.Is(err, device.ErrUnderRange):
+		return &ReadError{Class: ErrImplausible, Err: err}
+	}
+	return &ReadError{Class: ErrIO, Err: err}
+}
+
+// checked classifies and counts the result of a read, an invalid sample
+// count never reached the chip.
+func (n *NAU7802) checked(err error) error {
+	if errors.Is(err, device.ErrInvalidSampleCount) {
+		return ErrInvalidSampleCount
+	}
+	return n.count(nau7802Error(err))
+}
+
+func (n *NAU7802) ReadRaw(samples int) (int, error) {
+	raw, err := n.Dev.GetAverage(samples)
+	return int(raw), n.checked(err)
+}
+
+func (n *NAU7802) ReadWeight(samples int) (float64, error) {
+	weight, err := n.Dev.GetWeight(true, samples)
+	return weight, n.checked(err)
+}
+
+func (n *NAU7802) Tare(samples int) error {
+	return n.checked(n.Dev.CalculateZeroOffset(samples))
+}
+
+func (n *NAU7802) Calibrate(knownWeight float64, samples int) error {
+	if err := validateWeight(knownWeight); err != nil {
+		return err
+	}
+
+	previous := n.Dev.GetCalibrationFactor()
+	if err := n.checked(n.Dev.CalculateCalibrationFactor(knownWeight, samples)); err != nil {
+		return err
+	}
+	if n.Dev.GetCalibrationFactor() == 0 {
+		n.Dev.SetCalibrationFactor(previous)
+		return errSameAsZero(knownWeight)
+	}
+
+	n.Dev.SetCurve(nil)
+	return nil
+}
+
+func (n *NAU7802) GetCalibration() Calibration {
+	return Calibration{
+		Zero:   int(n.Dev.GetZeroOffset()),
+		Factor: n.Dev.GetCalibrationFactor(),
+		Curve:  n.Dev.GetCurve(),
+	}
+}
+
+func (n *NAU7802) SetCalibration(c Calibration) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	n.Dev.SetZeroOffset(int32(c.Zero))
+	n.Dev.SetCalibrationFactor(c.Factor)
+	n.Dev.SetCurve(c.Curve)
+	return nil
+}
+
+// Stream reports saturated conversions as ErrImplausible.
+func (n *NAU7802) Stream(ctx context.Context) <-chan Reading {
+	ch := make(chan Reading, 16)
+	samples := n.Dev.Stream(ctx)
+
+	go func() {
+		defer close(ch)
+
+		for s := range samples {
+			err := s.Err
+			switch {
+			case s.Flags&device.FlagOverRange != 0:
+				err = device.ErrOverRange
+			case s.Flags&device.FlagUnderRange != 0:
+				err = device.ErrUnderRange
+			}
+			r := Reading{Time: s.Time, Channel: s.Channel, Raw: int(s.Raw), Weight: s.Weight, Err: n.checked(err)}
+
+			select {
+			case ch <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+func (n *NAU7802) Close() error {
+	return n.Dev.Close()
+}
@@ -0,0 +1,126 @@
+package scale
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/SimonWaldherr/rpi-examples/calibration"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/sim"
+)
+
+// simNAU7802 returns the Scale of a simulated NAU7802 reading raw on the
+// selected channel.
+func simNAU7802(t *testing.T, raw int32) (*sim.NAU7802, *NAU7802) {
+	t.Helper()
+
+	chip := sim.New()
+	chip.SetRaw(device.NAU7802_CHANNEL_1, raw)
+	dev := device.New(chip)
+	if err := dev.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return chip, NewNAU7802(dev)
+}
+
+func TestNAU7802Calibration(t *testing.T) {
+	curve := &calibration.Curve{
+		Kind:   calibration.Piecewise,
+		Points: []calibration.Point{{Raw: 0, Weight: 0}, {Raw: 1000, Weight: 50}},
+	}
+
+	tests := []struct {
+		name   string
+		cal    Calibration
+		weight float64
+		valid  bool
+	}{
+		{"factor", Calibration{Zero: 1000, Factor: 10}, 200, true},
+		{"negative factor", Calibration{Zero: -1000, Factor: -20}, -200, true},
+		{"curve", Calibration{Zero: 1000, Factor: 10, Curve: curve}, 100, true},
+		{"zero factor", Calibration{Zero: 1000}, 0, false},
+		{"infinite factor", Calibration{Factor: math.Inf(1)}, 0, false},
+		{"invalid curve", Calibration{Factor: 10, Curve: &calibration.Curve{Kind: calibration.Piecewise}}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, n := simNAU7802(t, 3000)
+			before := n.GetCalibration()
+
+			err := n.SetCalibration(tt.cal)
+			if !tt.valid {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				if got := n.GetCalibration(); !reflect.DeepEqual(got, before) {
+					t.Errorf("calibration %+v after an error, want %+v", got, before)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the calibration is the one of the driver
+			if n.Dev.GetZeroOffset() != int32(tt.cal.Zero) || n.Dev.GetCalibrationFactor() != tt.cal.Factor || n.Dev.GetCurve() != tt.cal.Curve {
+				t.Errorf("driver zero %d factor %v curve %v, want %+v", n.Dev.GetZeroOffset(), n.Dev.GetCalibrationFactor(), n.Dev.GetCurve(), tt.cal)
+			}
+			if got := n.GetCalibration(); !reflect.DeepEqual(got, tt.cal) {
+				t.Errorf("got %+v, want %+v", got, tt.cal)
+			}
+
+			weight, err := n.ReadWeight(1)
+			if err != nil || math.Abs(weight-tt.weight) > 1e-9 {
+				t.Errorf("weight %v, %v, want %v", weight, err, tt.weight)
+			}
+		})
+	}
+}
+
+func TestNAU7802TareCalibrate(t *testing.T) {
+	chip, n := simNAU7802(t, 1500)
+	if err := n.SetCalibration(Calibration{Factor: 1, Curve: &calibration.Curve{Kind: calibration.Linear, Scale: 1, Coefficients: []float64{0, 1}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Tare(2); err != nil {
+		t.Fatal(err)
+	}
+	if n.Dev.GetZeroOffset() != 1500 {
+		t.Fatalf("zero offset %d after the tare, want 1500", n.Dev.GetZeroOffset())
+	}
+
+	// at the zero offset there is nothing to calibrate with
+	if err := n.Calibrate(50, 2); err == nil {
+		t.Error("calibrated with the reading of the zero offset")
+	}
+	if err := n.Calibrate(0, 2); err == nil {
+		t.Error("calibrated with a reference weight of 0")
+	}
+	if n.Dev.GetCalibrationFactor() != 1 {
+		t.Errorf("factor %v after failed calibrations, want 1", n.Dev.GetCalibrationFactor())
+	}
+
+	chip.SetRaw(device.NAU7802_CHANNEL_1, 2000)
+	if err := n.Calibrate(50, 2); err != nil {
+		t.Fatal(err)
+	}
+	want := Calibration{Zero: 1500, Factor: 10}
+	if got := n.GetCalibration(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v without the curve", got, want)
+	}
+}
+
+func TestNAU7802InvalidSamples(t *testing.T) {
+	_, n := simNAU7802(t, 1500)
+
+	if _, err := n.ReadRaw(0); !errors.Is(err, ErrInvalidSampleCount) {
+		t.Errorf("got %v, want %v", err, ErrInvalidSampleCount)
+	}
+	if counts := n.GetErrorCounts(); counts.Errors() != 0 {
+		t.Errorf("%v counted for a read that never reached the chip", counts)
+	}
+}
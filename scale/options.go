@@ -0,0 +1,287 @@
+package scale
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SimonWaldherr/rpi-examples/filter"
+	"github.com/SimonWaldherr/rpi-examples/i2cconf"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/device"
+	"github.com/SimonWaldherr/rpi-examples/nau7802/sim"
+)
+
+// Names of the ADCs for the -adc flag. Sim is a simulated NAU7802.
+const (
+	ADC_HX711   = "hx711"
+	ADC_NAU7802 = "nau7802"
+	ADC_SIM     = "sim"
+)
+
+// Options are the flags that select and open the ADC of a tool.
+type Options struct {
+	fs      *flag.FlagSet
+	adc     string
+	profile string
+	i2c     *i2cconf.Options
+	nau7802 *i2cconf.Setting
+
+	boardPath string
+	clockPin  string
+	dataPin   string
+	gain      int
+	filter    string
+	monitor   *MonitorOptions
+	record    *RecordOptions
+	tares     string
+	tare      string
+
+	// board is the HX711 profile with the flags applied, boardLoaded
+	// tells whether it was read from a file
+	board       HX711Profile
+	boardLoaded bool
+}
+
+// NewOptions registers -adc, -filter, -tares, -tare, the flags of
+// NewMonitorOptions and NewRecordOptions and the flags of the HX711 and
+// NAU7802 on fs:
+// -board, -clock, -data and -gain for the HX711, -profile, -bus,
+// -i2c-config and -addr for the NAU7802.
+func NewOptions(fs *flag.FlagSet) *Options {
+	o := &Options{fs: fs}
+	fs.StringVar(&o.adc, "adc", ADC_HX711, "ADC of the load cell: hx711, nau7802 or sim")
+	fs.StringVar(&o.boardPath, "board", "hx711.json", "profile of the HX711 board written by hx711/calib")
+	fs.StringVar(&o.clockPin, "clock", "", "clock pin of the HX711, default from -board or 6")
+	fs.StringVar(&o.dataPin, "data", "", "data pin of the HX711, default from -board or 5")
+	fs.IntVar(&o.gain, "gain", 0, "gain of the HX711, 128 or 64 on channel A, 32 on channel B, default from -board or 128")
+	fs.StringVar(&o.profile, "profile", "nau7802.json", "profile of the NAU7802")
+	fs.StringVar(&o.filter, "filter", "", "filter chain of the stream, e.g. mad:9:3.5,median:5,ema:0.2, default from the profile")
+	fs.StringVar(&o.tares, "tares", "tares.json", "stored tares of containers")
+	fs.StringVar(&o.tare, "tare", "", "preset tare weight or name of a stored tare")
+	o.monitor = NewMonitorOptions(fs, Stability{Window: 10, Tolerance: 1}, ZeroTracking{Rate: 0.5})
+	o.record = NewRecordOptions(fs)
+	o.i2c = i2cconf.NewOptions(fs)
+	o.nau7802 = o.i2c.Add("nau7802", "addr", i2cconf.NAU7802, device.DEVICE_ADDRESS)
+	return o
+}
+
+// I2C returns the I2C flags, tools add the other chips on the bus there.
+func (o *Options) I2C() *i2cconf.Options {
+	return o.i2c
+}
+
+// ADC returns the selected ADC.
+func (o *Options) ADC() string {
+	return o.adc
+}
+
+// Record returns the -record and -replay flags, for tools that open a
+// scale of their own.
+func (o *Options) Record() *RecordOptions {
+	return o.record
+}
+
+// Replaying tells whether Open plays back a recording of -replay instead
+// of opening the ADC.
+func (o *Options) Replaying() bool {
+	return o.record.Replaying()
+}
+
+func (o *Options) visited() map[string]bool {
+	set := make(map[string]bool)
+	o.fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// loadBoard reads the HX711 profile, without a file it returns the default
+// profile.
+func (o *Options) loadBoard() (HX711Profile, bool, error) {
+	p, err := LoadHX711Profile(o.boardPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultHX711Profile(), false, nil
+	}
+	return p, err == nil, err
+}
+
+// hx711Profile returns the HX711 profile with the flags applied. Selecting
+// channel B with -gain 32 on a board with a second load cell reads that
+// one.
+func (o *Options) hx711Profile() (HX711Profile, error) {
+	p, loaded, err := o.loadBoard()
+	if err != nil {
+		return p, err
+	}
+
+	if o.clockPin != "" {
+		p.ClockPin = o.clockPin
+	}
+	if o.dataPin != "" {
+		p.DataPin = o.dataPin
+	}
+	if o.gain != 0 {
+		before, _ := HX711Channel(p.Gain)
+		after, err := HX711Channel(o.gain)
+		if err != nil {
+			return p, err
+		}
+		if before != after && p.ChannelB != nil {
+			p.Calibration, p.ChannelB = *p.ChannelB, nil
+		}
+		p.Gain = o.gain
+	}
+
+	o.board, o.boardLoaded = p, loaded
+	return p, p.Validate()
+}
+
+// Open opens and initializes the selected ADC after the flags were parsed.
+// The HX711 is set up from its board profile, the NAU7802 from its
+// profile. Missing files are replaced by the defaults, hx711/calib
+// creates them.
+func (o *Options) Open() (Scale, error) {
+	switch o.adc {
+	case ADC_HX711:
+		p, err := o.hx711Profile()
+		if err != nil {
+			return nil, err
+		}
+		return o.filtered(p.Filter, func() (Scale, error) { return p.Open() })
+	case ADC_NAU7802, ADC_SIM:
+	default:
+		return nil, fmt.Errorf("scale: unknown adc %q", o.adc)
+	}
+
+	profile, err := o.nau7802Profile()
+	if err != nil {
+		return nil, err
+	}
+	return o.filtered(profile.Filter, func() (Scale, error) { return o.openNAU7802(profile) })
+}
+
+// filtered opens the scale, or the replay of -replay, with the chain of
+// -filter, otherwise of the recording or the profile, the stability
+// detection and zero tracking of the flags and the tare of -tare. The
+// scale returned is a *Tared.
+func (o *Options) filtered(spec string, open func() (Scale, error)) (Scale, error) {
+	if o.filter != "" {
+		spec = o.filter
+	}
+
+	memory, err := LoadTareMemory(o.tares)
+	if err != nil {
+		return nil, err
+	}
+
+	s, recorded, err := o.record.Open(open, spec)
+	if err != nil {
+		return nil, err
+	}
+	if o.filter == "" {
+		spec = recorded
+	}
+	chain, err := filter.Parse(spec)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	t := NewTared(o.monitor.Wrap(NewFiltered(s, chain)), memory, o.tares)
+	if o.tare != "" {
+		if err = t.SelectTare(o.tare); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (o *Options) openNAU7802(profile device.Profile) (Scale, error) {
+	var err error
+
+	var dev *device.NAU7802
+	if o.adc == ADC_SIM {
+		chip := sim.New()
+		chip.Noise = 50
+		chip.SetRaw(device.NAU7802_CHANNEL_1, -22872)
+		chip.SetRaw(device.NAU7802_CHANNEL_2, 10250)
+		dev = device.New(chip)
+	} else {
+		if err = o.i2c.Resolve(); err != nil {
+			return nil, err
+		}
+		if dev, err = device.NewNAU7802(o.nau7802.Bus, int(o.nau7802.Address)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = dev.InitializeProfile(profile); err != nil {
+		dev.Close()
+		return nil, err
+	}
+	return NewNAU7802(dev), nil
+}
+
+func (o *Options) nau7802Profile() (device.Profile, error) {
+	profile, err := device.LoadProfile(o.profile)
+	if errors.Is(err, os.ErrNotExist) {
+		return device.DefaultProfile(), nil
+	}
+	return profile, err
+}
+
+// Adjust sets the calibration of an opened scale from the -zero, -scale
+// and -curve flags of the tools, given in c. Without a board profile the
+// HX711 uses c, otherwise only the flags given on the command line replace
+// the values of the board or NAU7802 profile, or of a recording.
+func (o *Options) Adjust(s Scale, c Calibration) error {
+	set := o.visited()
+
+	cal := s.GetCalibration()
+	if o.adc == ADC_HX711 && !o.boardLoaded && !o.Replaying() {
+		cal = c
+	}
+
+	if set["zero"] {
+		cal.Zero = c.Zero
+	}
+	if set["scale"] {
+		cal.Factor, cal.Curve = c.Factor, nil
+	}
+	if set["curve"] {
+		cal.Curve = c.Curve
+	}
+	return s.SetCalibration(cal)
+}
+
+// SaveCalibration stores the calibration of the channel in use in the
+// profile of the ADC and returns its path. For the HX711 the pins and the
+// gain are stored along, calibrating channel B with -gain 32 on a board
+// with a load cell on channel A adds a second load cell.
+func (o *Options) SaveCalibration(c Calibration) (string, error) {
+	if o.adc != ADC_HX711 {
+		profile, err := o.nau7802Profile()
+		if err != nil {
+			return o.profile, err
+		}
+		profile.ZeroOffset = int32(c.Zero)
+		profile.CalibrationFactor = c.Factor
+		profile.Curve = c.Curve
+		return o.profile, profile.Save(o.profile)
+	}
+
+	p, _, err := o.loadBoard()
+	if err != nil {
+		return o.boardPath, err
+	}
+
+	stored, _ := HX711Channel(p.Gain)
+	used, _ := HX711Channel(o.board.Gain)
+	if o.boardLoaded && stored == HX711_CHANNEL_A && used == HX711_CHANNEL_B {
+		p.ChannelB = &c
+	} else {
+		p.ClockPin, p.DataPin, p.Gain = o.board.ClockPin, o.board.DataPin, o.board.Gain
+		p.Calibration = c
+	}
+	return o.boardPath, p.Save(o.boardPath)
+}
@@ -0,0 +1,104 @@
+package scale
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/SimonWaldherr/rpi-examples/filter"
+	"github.com/SimonWaldherr/rpi-examples/jsonfile"
+)
+
+// HX711Profile describes one HX711 board: its wiring, the gain and the
+// calibration of the load cells. It is stored as JSON by hx711/calib.
+type HX711Profile struct {
+	ClockPin string `json:"clock_pin"`
+	DataPin  string `json:"data_pin"`
+
+	// Gain selects the channel, 128 or 64 for channel A, 32 for channel B
+	Gain int `json:"gain"`
+
+	// Calibration of the channel selected by Gain
+	Calibration
+
+	// ChannelB is the calibration of a second load cell on channel B,
+	// if set both channels are read alternately
+	ChannelB *Calibration `json:"channel_b,omitempty"`
+
+	// Filter is the filter chain of the stream, see filter.Parse
+	Filter string `json:"filter,omitempty"`
+}
+
+// DefaultHX711Profile returns the wiring used by the examples: clock on
+// GPIO 6, data on GPIO 5 and channel A with a gain of 128.
+func DefaultHX711Profile() HX711Profile {
+	return HX711Profile{
+		ClockPin:    "6",
+		DataPin:     "5",
+		Gain:        HX711_GAIN_A128,
+		Calibration: Calibration{Factor: 1},
+	}
+}
+
+// LoadHX711Profile reads a profile, fields missing in the file keep the
+// values of DefaultHX711Profile.
+func LoadHX711Profile(path string) (HX711Profile, error) {
+	p := DefaultHX711Profile()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+
+	if err = json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("scale: %s: %v", path, err)
+	}
+
+	return p, p.Validate()
+}
+
+// Save writes the profile as JSON, the file is replaced atomically.
+func (p HX711Profile) Save(path string) error {
+	return jsonfile.Save(path, p)
+}
+
+// Validate checks the gain and the calibrations.
+func (p HX711Profile) Validate() error {
+	if p.ClockPin == "" || p.DataPin == "" {
+		return fmt.Errorf("scale: hx711 clock and data pin must be set")
+	}
+	channel, err := HX711Channel(p.Gain)
+	if err != nil {
+		return err
+	}
+	if err = p.Calibration.Validate(); err != nil {
+		return err
+	}
+	if _, err = filter.Parse(p.Filter); err != nil {
+		return err
+	}
+	if p.ChannelB != nil {
+		if channel != HX711_CHANNEL_A {
+			return fmt.Errorf("scale: channel_b needs a gain of 128 or 64 on channel A")
+		}
+		return p.ChannelB.Validate()
+	}
+	return nil
+}
+
+// Open opens the HX711 of the profile with its gain and calibrations.
+func (p HX711Profile) Open() (*HX711, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	h, err := NewHX711(p.ClockPin, p.DataPin)
+	if err != nil {
+		return nil, err
+	}
+
+	h.SetGain(p.Gain)
+	h.SetCalibration(p.Calibration)
+	h.SetSecondChannel(p.ChannelB)
+	return h, nil
+}
@@ -0,0 +1,112 @@
+package scale
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestHX711ProfileValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(p *HX711Profile)
+		valid  bool
+	}{
+		{"default", func(p *HX711Profile) {}, true},
+		{"channel B", func(p *HX711Profile) { p.Gain = HX711_GAIN_B32 }, true},
+		{"both channels", func(p *HX711Profile) { p.ChannelB = &Calibration{Factor: 2} }, true},
+		{"no clock pin", func(p *HX711Profile) { p.ClockPin = "" }, false},
+		{"no data pin", func(p *HX711Profile) { p.DataPin = "" }, false},
+		{"invalid gain", func(p *HX711Profile) { p.Gain = 16 }, false},
+		{"invalid calibration", func(p *HX711Profile) { p.Factor = 0 }, false},
+		{"invalid filter", func(p *HX711Profile) { p.Filter = "median:0" }, false},
+		{"channel_b with gain 32", func(p *HX711Profile) {
+			p.Gain = HX711_GAIN_B32
+			p.ChannelB = &Calibration{Factor: 2}
+		}, false},
+		{"invalid channel_b", func(p *HX711Profile) { p.ChannelB = &Calibration{} }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := DefaultHX711Profile()
+			tt.change(&p)
+			err := p.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("got %v, want valid", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
+
+func TestLoadHX711Profile(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want func(p *HX711Profile)
+		err  bool
+	}{
+		{"calibration only", `{"zero": 8500, "factor": 412.5}`, func(p *HX711Profile) {
+			p.Zero, p.Factor = 8500, 412.5
+		}, false},
+		{"board", `{"clock_pin": "23", "data_pin": "24", "gain": 32, "zero": -100, "factor": -3}`, func(p *HX711Profile) {
+			p.ClockPin, p.DataPin, p.Gain, p.Zero, p.Factor = "23", "24", HX711_GAIN_B32, -100, -3
+		}, false},
+		{"both channels", `{"factor": 2, "channel_b": {"zero": 5, "factor": 3}, "filter": "median:5"}`, func(p *HX711Profile) {
+			p.Factor, p.ChannelB, p.Filter = 2, &Calibration{Zero: 5, Factor: 3}, "median:5"
+		}, false},
+		{"invalid gain", `{"gain": 16}`, nil, true},
+		{"no JSON", `gain: 128`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "hx711.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := LoadHX711Profile(path)
+			if tt.err {
+				if err == nil {
+					t.Errorf("got %+v, want an error", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := DefaultHX711Profile()
+			tt.want(&want)
+			if !reflect.DeepEqual(p, want) {
+				t.Fatalf("got %+v, want %+v", p, want)
+			}
+
+			// a saved profile loads the same
+			if err = p.Save(path); err != nil {
+				t.Fatal(err)
+			}
+			if p, err = LoadHX711Profile(path); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(p, want) {
+				t.Errorf("after saving got %+v, want %+v", p, want)
+			}
+		})
+	}
+
+	// without a file the options fall back to the defaults
+	p, err := LoadHX711Profile(filepath.Join(t.TempDir(), "missing.json"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v, want %v", err, fs.ErrNotExist)
+	}
+	if !reflect.DeepEqual(p, DefaultHX711Profile()) {
+		t.Errorf("got %+v without a file, want the defaults", p)
+	}
+}
@@ -0,0 +1,384 @@
+package scale
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// A recording keeps the readings of an ADC as the tool got them, raw and
+// as weight, together with the calibration in effect, so a tool can be run
+// again on the same readings on another machine. After the magic, a
+// version byte and the length of the JSON RecordingHeader as uvarint the
+// records follow, each is
+//
+//	uvarint  microseconds since the record before, or the header time
+//	byte     kind, one of the record* constants
+//
+// and for samples, reads and errors
+//
+//	byte     channel
+//	byte     gain
+//	varint   raw count (samples and reads of ReadRaw)
+//	float64  weight, little endian (samples and reads of ReadWeight)
+//	byte     class, uvarint length, message (errors)
+//
+// or for a calibration the uvarint length and the JSON Calibration. The
+// start of a stream has no data.
+const (
+	recordingMagic   = "SCALEREC"
+	recordingVersion = 1
+)
+
+// Kinds of records. Samples and errors come from Stream, reads from
+// ReadRaw and weights from ReadWeight.
+const (
+	recordSample byte = iota
+	recordError
+	recordRead
+	recordReadError
+	recordCalibration
+	recordStream
+	recordWeight
+)
+
+// Classes of errors in a recording, errors without a class are stored as
+// classNone.
+const (
+	classNone byte = iota
+	classNotReady
+	classIO
+	classImplausible
+)
+
+var ErrBadRecording = errors.New("scale: not a recording")
+
+// RecordingHeader describes the ADC a recording was taken with.
+type RecordingHeader struct {
+	// ADC is the adapter, ADC_HX711 or ADC_NAU7802, empty for others.
+	ADC  string    `json:"adc"`
+	Time time.Time `json:"time"`
+
+	// Gain and Calibration of the channel in use, ChannelB is the
+	// calibration of a second load cell on channel B of an HX711.
+	Gain        int          `json:"gain"`
+	Calibration Calibration  `json:"calibration"`
+	ChannelB    *Calibration `json:"channel_b,omitempty"`
+
+	// Filter is the chain the tool ran the stream through, in the syntax
+	// of filter.Parse.
+	Filter string `json:"filter,omitempty"`
+}
+
+// secondChannel tells whether the readings of channel are converted with
+// ChannelB rather than Calibration.
+func (h RecordingHeader) secondChannel(channel int) bool {
+	return h.ADC == ADC_HX711 && channel == HX711_CHANNEL_B && h.ChannelB != nil
+}
+
+// Record is an entry of a recording. Reading is the reading as the tool
+// got it. Read tells it came from ReadRaw or ReadWeight rather than
+// Stream, a read of ReadRaw has no weight and one of ReadWeight, Weighed,
+// no raw count. A record with Calibration set is a change of the
+// calibration, one with Stream the start of a stream.
+type Record struct {
+	Reading
+	Gain        int
+	Read        bool
+	Weighed     bool
+	Stream      bool
+	Calibration *Calibration
+}
+
+func errorClass(err error) byte {
+	switch {
+	case errors.Is(err, ErrNotReady):
+		return classNotReady
+	case errors.Is(err, ErrIO):
+		return classIO
+	case errors.Is(err, ErrImplausible):
+		return classImplausible
+	}
+	return classNone
+}
+
+// recordedError returns the error of a recording as it was classified.
+func recordedError(class byte, message string) error {
+	err := errors.New(message)
+	switch class {
+	case classNotReady:
+		return &ReadError{Class: ErrNotReady, Err: err}
+	case classIO:
+		return &ReadError{Class: ErrIO, Err: err}
+	case classImplausible:
+		return &ReadError{Class: ErrImplausible, Err: err}
+	}
+	return err
+}
+
+// recordingWriter encodes records to a file. Every record is flushed, so
+// a tool stopped by log.Fatal leaves a complete recording.
+type recordingWriter struct {
+	f    *os.File
+	w    *bufio.Writer
+	last time.Time
+	buf  []byte
+}
+
+func createRecording(path string, h RecordingHeader) (*recordingWriter, error) {
+	header, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rw := &recordingWriter{f: f, w: bufio.NewWriter(f), last: h.Time}
+	rw.w.WriteString(recordingMagic)
+	rw.w.WriteByte(recordingVersion)
+	rw.bytes(header)
+	return rw, nil
+}
+
+func (rw *recordingWriter) uvarint(v uint64) {
+	rw.buf = binary.AppendUvarint(rw.buf[:0], v)
+	rw.w.Write(rw.buf)
+}
+
+func (rw *recordingWriter) bytes(b []byte) {
+	rw.uvarint(uint64(len(b)))
+	rw.w.Write(b)
+}
+
+// start writes the time and the kind of a record.
+func (rw *recordingWriter) start(t time.Time, kind byte) {
+	dt := t.Sub(rw.last).Microseconds()
+	if dt < 0 {
+		dt = 0
+	}
+	rw.last = rw.last.Add(time.Duration(dt) * time.Microsecond)
+	rw.uvarint(uint64(dt))
+	rw.w.WriteByte(kind)
+}
+
+func (rw *recordingWriter) weight(w float64) {
+	rw.buf = binary.LittleEndian.AppendUint64(rw.buf[:0], math.Float64bits(w))
+	rw.w.Write(rw.buf)
+}
+
+// reading writes a sample of Stream, or with read a read of ReadRaw.
+func (rw *recordingWriter) reading(r Reading, gain int, read bool) error {
+	kind := recordSample
+	if read {
+		kind = recordRead
+	}
+	if r.Err != nil {
+		return rw.failed(r, gain, kind+1)
+	}
+
+	rw.start(r.Time, kind)
+	rw.w.WriteByte(byte(r.Channel))
+	rw.w.WriteByte(byte(gain))
+	rw.buf = binary.AppendVarint(rw.buf[:0], int64(r.Raw))
+	rw.w.Write(rw.buf)
+	if !read {
+		rw.weight(r.Weight)
+	}
+	return rw.w.Flush()
+}
+
+// weighed writes a read of ReadWeight.
+func (rw *recordingWriter) weighed(r Reading, gain int) error {
+	if r.Err != nil {
+		return rw.failed(r, gain, recordReadError)
+	}
+
+	rw.start(r.Time, recordWeight)
+	rw.w.WriteByte(byte(r.Channel))
+	rw.w.WriteByte(byte(gain))
+	rw.weight(r.Weight)
+	return rw.w.Flush()
+}
+
+func (rw *recordingWriter) failed(r Reading, gain int, kind byte) error {
+	rw.start(r.Time, kind)
+	rw.w.WriteByte(byte(r.Channel))
+	rw.w.WriteByte(byte(gain))
+
+	message := r.Err.Error()
+	var readErr *ReadError
+	if errors.As(r.Err, &readErr) {
+		message = readErr.Err.Error()
+	}
+	rw.w.WriteByte(errorClass(r.Err))
+	rw.bytes([]byte(message))
+	return rw.w.Flush()
+}
+
+func (rw *recordingWriter) calibration(t time.Time, c Calibration) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	rw.start(t, recordCalibration)
+	rw.bytes(data)
+	return rw.w.Flush()
+}
+
+func (rw *recordingWriter) stream(t time.Time) error {
+	rw.start(t, recordStream)
+	return rw.w.Flush()
+}
+
+func (rw *recordingWriter) Close() error {
+	err := rw.w.Flush()
+	if cerr := rw.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// RecordingReader decodes a recording.
+type RecordingReader struct {
+	Header RecordingHeader
+
+	f    *os.File
+	r    *bufio.Reader
+	last time.Time
+}
+
+// OpenRecording opens a recording and reads its header.
+func OpenRecording(path string) (*RecordingReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rr := &RecordingReader{f: f, r: bufio.NewReader(f)}
+	if err = rr.header(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s: %v", ErrBadRecording, path, err)
+	}
+	return rr, nil
+}
+
+func (rr *RecordingReader) header() error {
+	magic := make([]byte, len(recordingMagic)+1)
+	if _, err := io.ReadFull(rr.r, magic); err != nil {
+		return err
+	}
+	if string(magic[:len(recordingMagic)]) != recordingMagic {
+		return fmt.Errorf("unknown format")
+	}
+	if magic[len(recordingMagic)] != recordingVersion {
+		return fmt.Errorf("unknown version %d", magic[len(recordingMagic)])
+	}
+
+	data, err := rr.bytes()
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, &rr.Header); err != nil {
+		return err
+	}
+
+	rr.last = rr.Header.Time
+	return nil
+}
+
+func (rr *RecordingReader) bytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(rr.r)
+	if err != nil {
+		return nil, err
+	}
+	if n > 1<<20 {
+		return nil, fmt.Errorf("record of %d bytes", n)
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(rr.r, b)
+	return b, err
+}
+
+// Next returns the next record, io.EOF at the end of the recording.
+func (rr *RecordingReader) Next() (Record, error) {
+	dt, err := binary.ReadUvarint(rr.r)
+	if err != nil {
+		return Record{}, err
+	}
+	kind, err := rr.r.ReadByte()
+	if err != nil {
+		return Record{}, io.ErrUnexpectedEOF
+	}
+	rr.last = rr.last.Add(time.Duration(dt) * time.Microsecond)
+
+	rec := Record{Reading: Reading{Time: rr.last}}
+	switch kind {
+	case recordCalibration:
+		data, err := rr.bytes()
+		if err != nil {
+			return rec, io.ErrUnexpectedEOF
+		}
+		var c Calibration
+		if err = json.Unmarshal(data, &c); err != nil {
+			return rec, fmt.Errorf("%w: calibration: %v", ErrBadRecording, err)
+		}
+		rec.Calibration = &c
+		return rec, nil
+	case recordStream:
+		rec.Stream = true
+		return rec, nil
+	case recordSample, recordError, recordRead, recordReadError, recordWeight:
+	default:
+		return rec, fmt.Errorf("%w: unknown record %d", ErrBadRecording, kind)
+	}
+
+	var head [2]byte
+	if _, err = io.ReadFull(rr.r, head[:]); err != nil {
+		return rec, io.ErrUnexpectedEOF
+	}
+	rec.Channel, rec.Gain = int(head[0]), int(head[1])
+	rec.Read = kind == recordRead || kind == recordReadError || kind == recordWeight
+	rec.Weighed = kind == recordWeight
+
+	if kind == recordSample || kind == recordRead {
+		raw, err := binary.ReadVarint(rr.r)
+		if err != nil {
+			return rec, io.ErrUnexpectedEOF
+		}
+		rec.Raw = int(raw)
+	}
+	if kind == recordSample || kind == recordWeight {
+		var w [8]byte
+		if _, err = io.ReadFull(rr.r, w[:]); err != nil {
+			return rec, io.ErrUnexpectedEOF
+		}
+		rec.Weight = math.Float64frombits(binary.LittleEndian.Uint64(w[:]))
+	}
+	if kind != recordError && kind != recordReadError {
+		return rec, nil
+	}
+
+	class, err := rr.r.ReadByte()
+	if err != nil {
+		return rec, io.ErrUnexpectedEOF
+	}
+	message, err := rr.bytes()
+	if err != nil {
+		return rec, io.ErrUnexpectedEOF
+	}
+	rec.Err = recordedError(class, string(message))
+	return rec, nil
+}
+
+func (rr *RecordingReader) Close() error {
+	return rr.f.Close()
+}
@@ -0,0 +1,476 @@
+package scale
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+var ErrEndOfRecording = errors.New("scale: end of recording")
+
+// Recorder writes the readings of a scale to a recording as the tool gets
+// them, so the weights of ReadWeight and Stream are the ones of the scale,
+// including the temperature compensation of the NAU7802. The header is
+// written with the first record, so it has the calibration the tool set
+// after opening the scale; later changes are recorded as they happen.
+type Recorder struct {
+	Scale
+
+	mu     sync.Mutex
+	path   string
+	filter string
+	header RecordingHeader
+	w      *recordingWriter
+	err    error
+}
+
+// NewRecorder records the readings of s to path. filter is the chain the
+// tool runs the stream through, it is kept in the header.
+func NewRecorder(s Scale, path, filter string) *Recorder {
+	return &Recorder{Scale: s, path: path, filter: filter}
+}
+
+// header describes the ADC below s.
+func header(s Scale) RecordingHeader {
+	h := RecordingHeader{Time: time.Now(), Calibration: s.GetCalibration()}
+
+	switch adc := Unwrap(s).(type) {
+	case *HX711:
+		h.ADC, h.Gain, h.ChannelB = ADC_HX711, adc.GetGain(), adc.GetSecondChannel()
+	case *NAU7802:
+		h.ADC = ADC_NAU7802
+		if c, err := adc.Dev.ReadConfig(); err == nil {
+			h.Gain = c.Gain
+		}
+	}
+	return h
+}
+
+// gain returns the gain of the readings of channel, the second channel of
+// an HX711 is read with a gain of 32.
+func (r *Recorder) gain(channel int) int {
+	if r.header.ADC == ADC_HX711 && channel == HX711_CHANNEL_B {
+		return HX711_GAIN_B32
+	}
+	return r.header.Gain
+}
+
+// record writes a record, the first error writing the file is returned by
+// Close.
+func (r *Recorder) record(write func(w *recordingWriter) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return
+	}
+	if r.w == nil {
+		r.header = header(r.Scale)
+		r.header.Filter = r.filter
+		if r.w, r.err = createRecording(r.path, r.header); r.err != nil {
+			return
+		}
+	}
+	r.err = write(r.w)
+}
+
+// calibrated records a change of the calibration once the recording runs.
+func (r *Recorder) calibrated(err error) error {
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.w != nil && r.err == nil {
+		r.err = r.w.calibration(time.Now(), r.Scale.GetCalibration())
+	}
+	return nil
+}
+
+func (r *Recorder) ReadRaw(samples int) (int, error) {
+	raw, err := r.Scale.ReadRaw(samples)
+	if !errors.Is(err, ErrInvalidSampleCount) {
+		reading := Reading{Time: time.Now(), Raw: raw, Err: err}
+		r.record(func(w *recordingWriter) error { return w.reading(reading, r.gain(0), true) })
+	}
+	return raw, err
+}
+
+func (r *Recorder) ReadWeight(samples int) (float64, error) {
+	weight, err := r.Scale.ReadWeight(samples)
+	if !errors.Is(err, ErrInvalidSampleCount) {
+		reading := Reading{Time: time.Now(), Weight: weight, Err: err}
+		r.record(func(w *recordingWriter) error { return w.weighed(reading, r.gain(0)) })
+	}
+	return weight, err
+}
+
+func (r *Recorder) Tare(samples int) error {
+	return r.calibrated(r.Scale.Tare(samples))
+}
+
+func (r *Recorder) Calibrate(knownWeight float64, samples int) error {
+	return r.calibrated(r.Scale.Calibrate(knownWeight, samples))
+}
+
+func (r *Recorder) SetCalibration(c Calibration) error {
+	return r.calibrated(r.Scale.SetCalibration(c))
+}
+
+// Stream marks the start of the stream in the recording, so a replay
+// leaves out the readings sent after the tool stopped reading.
+func (r *Recorder) Stream(ctx context.Context) <-chan Reading {
+	ch := make(chan Reading, 16)
+	now := time.Now()
+	r.record(func(w *recordingWriter) error { return w.stream(now) })
+	readings := r.Scale.Stream(ctx)
+
+	go func() {
+		defer close(ch)
+
+		for reading := range readings {
+			r.record(func(w *recordingWriter) error { return w.reading(reading, r.gain(reading.Channel), false) })
+
+			select {
+			case ch <- reading:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// Close closes the recording and the scale.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	err := r.err
+	if r.w != nil {
+		if cerr := r.w.Close(); err == nil {
+			err = cerr
+		}
+	}
+	r.mu.Unlock()
+
+	if cerr := r.Scale.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Replay is a Scale that plays back a recording in the order it was
+// recorded. ReadRaw and ReadWeight return the next recorded read, Stream
+// the readings of the next recorded stream in the pace they were recorded
+// with the original times, and it ends with them. Records the tool does
+// not ask for, e.g. the readings a stream sent after the tool stopped
+// reading, are skipped. The calibrations recorded take effect as they are
+// reached, Tare and Calibrate do not measure anything but play the one
+// they recorded if it is next.
+//
+// The weights are the recorded ones. Once the tool sets a calibration
+// other than the recorded one, the raw readings are converted with it,
+// which leaves out the temperature compensation of the NAU7802.
+type Replay struct {
+	mu       sync.Mutex
+	rec      *RecordingReader
+	next     *Record
+	recorded Calibration
+	cal      Calibration
+	streams  int
+
+	counter
+}
+
+// OpenReplay opens a recording to play back.
+func OpenReplay(path string) (*Replay, error) {
+	rec, err := OpenRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	cal := rec.Header.Calibration
+	return &Replay{rec: rec, recorded: cal, cal: cal}, nil
+}
+
+// Header returns the description of the recorded ADC.
+func (r *Replay) Header() RecordingHeader {
+	return r.rec.Header
+}
+
+// peek returns the next record without playing it.
+func (r *Replay) peek() (Record, error) {
+	if r.next == nil {
+		rec, err := r.rec.Next()
+		if err == io.EOF {
+			return rec, ErrEndOfRecording
+		}
+		if err != nil {
+			return rec, err
+		}
+		r.next = &rec
+	}
+	return *r.next, nil
+}
+
+// skip plays the record returned by peek, a recorded calibration takes
+// effect.
+func (r *Replay) skip() {
+	if c := r.next.Calibration; c != nil {
+		r.recorded, r.cal = *c, *c
+	}
+	r.next = nil
+}
+
+func sameCalibration(a, b Calibration) bool {
+	return a.Zero == b.Zero && a.Factor == b.Factor && a.Curve == b.Curve
+}
+
+// weight returns the weight of a recorded reading with the calibration in
+// effect.
+func (r *Replay) weight(rec Record) float64 {
+	if rec.Weighed || r.rec.Header.secondChannel(rec.Channel) {
+		return rec.Weight
+	}
+	if rec.Read || !sameCalibration(r.cal, r.recorded) {
+		return r.cal.Weight(rec.Raw)
+	}
+	return rec.Weight
+}
+
+// read plays the records up to the next read and returns it with the
+// weight set.
+func (r *Replay) read() (Record, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for {
+		rec, err := r.peek()
+		if err != nil {
+			return rec, err
+		}
+		r.skip()
+		if rec.Read {
+			if rec.Err == nil {
+				rec.Weight = r.weight(rec)
+			}
+			return rec, nil
+		}
+	}
+}
+
+func (r *Replay) ReadRaw(samples int) (int, error) {
+	if samples < 1 {
+		return 0, ErrInvalidSampleCount
+	}
+
+	rec, err := r.read()
+	if err != nil {
+		return 0, err
+	}
+	if rec.Weighed {
+		return 0, fmt.Errorf("scale: the recording has a weight without a raw reading at %v", rec.Time.Format(time.StampMicro))
+	}
+	return rec.Raw, r.count(rec.Err)
+}
+
+func (r *Replay) ReadWeight(samples int) (float64, error) {
+	if samples < 1 {
+		return 0, ErrInvalidSampleCount
+	}
+
+	rec, err := r.read()
+	if err != nil {
+		return 0, err
+	}
+	return rec.Weight, r.count(rec.Err)
+}
+
+// calibrated plays the calibration recorded by a tare or a calibration if
+// it is the next record.
+func (r *Replay) calibrated() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if rec, err := r.peek(); err == nil && rec.Calibration != nil {
+		r.skip()
+	}
+}
+
+func (r *Replay) Tare(samples int) error {
+	if samples < 1 {
+		return ErrInvalidSampleCount
+	}
+	r.calibrated()
+	return nil
+}
+
+func (r *Replay) Calibrate(knownWeight float64, samples int) error {
+	if err := validateWeight(knownWeight); err != nil {
+		return err
+	}
+	if samples < 1 {
+		return ErrInvalidSampleCount
+	}
+	r.calibrated()
+	return nil
+}
+
+func (r *Replay) GetCalibration() Calibration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cal
+}
+
+func (r *Replay) SetCalibration(c Calibration) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cal = c
+	return nil
+}
+
+// startStream plays the records up to the start of the next stream and
+// returns its number, false at the end of the recording.
+func (r *Replay) startStream() (int, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.streams++
+	for {
+		rec, err := r.peek()
+		if err != nil {
+			return 0, false
+		}
+		r.skip()
+		if rec.Stream {
+			return r.streams, true
+		}
+	}
+}
+
+// sample plays the records up to the next reading of stream, false at the
+// end of the stream, e.g. if a later one started.
+func (r *Replay) sample(stream int) (Record, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for stream == r.streams {
+		rec, err := r.peek()
+		if err != nil || rec.Stream || rec.Read {
+			return rec, false
+		}
+		r.skip()
+		if rec.Calibration == nil {
+			if rec.Err == nil {
+				rec.Weight = r.weight(rec)
+			}
+			return rec, true
+		}
+	}
+	return Record{}, false
+}
+
+// replaySlowdown slows the pace of a replayed stream down by a hundredth. A
+// tool that waits for some time while it reads takes the same readings or
+// fewer then, and does not run out of the recorded ones where the live run
+// took a reading just before the time was up.
+const replaySlowdown = 100
+
+// Stream ends with the recorded stream.
+func (r *Replay) Stream(ctx context.Context) <-chan Reading {
+	ch := make(chan Reading, 16)
+
+	go func() {
+		defer close(ch)
+
+		stream, ok := r.startStream()
+		if !ok {
+			return
+		}
+
+		var first time.Time
+		start := time.Now()
+
+		for {
+			rec, ok := r.sample(stream)
+			if !ok {
+				return
+			}
+
+			if first.IsZero() {
+				first = rec.Time
+			}
+			elapsed := rec.Time.Sub(first)
+			wait := time.NewTimer(time.Until(start.Add(elapsed + elapsed/replaySlowdown)))
+			select {
+			case <-wait.C:
+			case <-ctx.Done():
+				wait.Stop()
+				return
+			}
+
+			rec.Err = r.count(rec.Err)
+			select {
+			case ch <- rec.Reading:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+func (r *Replay) Close() error {
+	return r.rec.Close()
+}
+
+// RecordOptions are the -record and -replay flags.
+type RecordOptions struct {
+	Record string
+	Replay string
+}
+
+// NewRecordOptions registers -record and -replay on fs.
+func NewRecordOptions(fs *flag.FlagSet) *RecordOptions {
+	r := &RecordOptions{}
+	fs.StringVar(&r.Record, "record", "", "record the raw readings of the ADC to this file")
+	fs.StringVar(&r.Replay, "replay", "", "play back a recording of -record instead of reading the ADC")
+	return r
+}
+
+// Replaying tells whether the scale comes from a recording.
+func (r *RecordOptions) Replaying() bool {
+	return r.Replay != ""
+}
+
+// Open opens the replay of -replay, otherwise the scale of open, which
+// is recorded with -record along with filter, the chain the tool runs the
+// stream through. It returns the chain to use, the recorded one for a
+// replay.
+func (r *RecordOptions) Open(open func() (Scale, error), filter string) (Scale, string, error) {
+	if r.Replay != "" {
+		replay, err := OpenReplay(r.Replay)
+		if err != nil {
+			return nil, filter, err
+		}
+		return replay, replay.Header().Filter, nil
+	}
+
+	s, err := open()
+	if err != nil || r.Record == "" {
+		return s, filter, err
+	}
+	return NewRecorder(s, r.Record, filter), filter, nil
+}
@@ -0,0 +1,136 @@
+package scale
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// compensated is a scale whose weights differ from the calibrated raw
+// readings by drift, like the temperature compensation of the NAU7802.
+type compensated struct {
+	raw   int
+	drift float64
+	cal   Calibration
+
+	counter
+}
+
+func (s *compensated) ReadRaw(samples int) (int, error) {
+	s.raw += 10
+	return s.raw, s.count(nil)
+}
+
+func (s *compensated) ReadWeight(samples int) (float64, error) {
+	raw, err := s.ReadRaw(samples)
+	return s.cal.Weight(raw) + s.drift, err
+}
+
+func (s *compensated) Tare(samples int) error {
+	s.cal.Zero = s.raw
+	return nil
+}
+
+func (s *compensated) Calibrate(knownWeight float64, samples int) error {
+	return nil
+}
+
+func (s *compensated) GetCalibration() Calibration {
+	return s.cal
+}
+
+func (s *compensated) SetCalibration(c Calibration) error {
+	s.cal = c
+	return nil
+}
+
+// Stream sends five readings and then waits for ctx.
+func (s *compensated) Stream(ctx context.Context) <-chan Reading {
+	ch := make(chan Reading)
+	start, cal := s.raw, s.cal
+	go func() {
+		defer close(ch)
+		for i := 1; i <= 5; i++ {
+			raw := start + 100*i
+			reading := Reading{Time: time.Now(), Raw: raw, Weight: cal.Weight(raw) + s.drift}
+			select {
+			case ch <- reading:
+			case <-ctx.Done():
+				return
+			}
+		}
+		<-ctx.Done()
+	}()
+	return ch
+}
+
+func (s *compensated) Close() error {
+	return nil
+}
+
+func TestReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.rec")
+
+	live := &compensated{raw: 1000, drift: 0.5, cal: Calibration{Factor: 10}}
+	rec := NewRecorder(live, path, "median:5")
+
+	before, _ := rec.ReadWeight(1)
+	if err := rec.Tare(1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var streamed []float64
+	for reading := range rec.Stream(ctx) {
+		if streamed = append(streamed, reading.Weight); len(streamed) == 3 {
+			cancel()
+			break
+		}
+	}
+	raw, _ := rec.ReadRaw(1)
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := OpenReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+
+	if got := replay.Header().Filter; got != "median:5" {
+		t.Errorf("filter of the header is %q, want median:5", got)
+	}
+	if got, _ := replay.ReadWeight(1); got != before {
+		t.Errorf("ReadWeight got %v, want the recorded %v", got, before)
+	}
+	if err := replay.Tare(1); err != nil {
+		t.Fatal(err)
+	}
+	if got := replay.GetCalibration(); got.Zero != live.cal.Zero {
+		t.Errorf("zero after the tare is %d, want the recorded %d", got.Zero, live.cal.Zero)
+	}
+
+	var replayed []float64
+	for reading := range replay.Stream(context.Background()) {
+		replayed = append(replayed, reading.Weight)
+	}
+	if len(replayed) < len(streamed) {
+		t.Fatalf("stream got %v, want at least %v", replayed, streamed)
+	}
+	for i, w := range streamed {
+		if replayed[i] != w {
+			t.Errorf("reading %d of the stream is %v, want %v", i, replayed[i], w)
+		}
+	}
+
+	if got, _ := replay.ReadRaw(1); got != raw {
+		t.Errorf("ReadRaw after the stream got %d, want %d", got, raw)
+	}
+	if _, err := replay.ReadRaw(1); !errors.Is(err, ErrEndOfRecording) {
+		t.Errorf("read after the last record got %v, want %v", err, ErrEndOfRecording)
+	}
+}
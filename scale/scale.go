@@ -0,0 +1,124 @@
+// Package scale puts the HX711 and the NAU7802 behind a common interface,
+// so tools built on top of a load cell work with either ADC. Both adapters
+// keep a zero offset and a calibration, either a linear factor in counts
+// per unit or a curve from the calibration package.
+package scale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/SimonWaldherr/rpi-examples/calibration"
+)
+
+var ErrInvalidSampleCount = errors.New("scale: sample count must be positive")
+
+// Scale is a load cell behind an ADC.
+type Scale interface {
+	// ReadRaw returns a reading combined from samples conversions, the
+	// HX711 takes the median and the NAU7802 the mean.
+	ReadRaw(samples int) (int, error)
+
+	// ReadWeight returns the weight of a reading from samples conversions.
+	ReadWeight(samples int) (float64, error)
+
+	// Tare measures the empty scale and makes it the zero offset.
+	Tare(samples int) error
+
+	// Calibrate measures knownWeight on the tared scale and sets the
+	// linear calibration factor, a curve is dropped.
+	Calibrate(knownWeight float64, samples int) error
+
+	GetCalibration() Calibration
+	SetCalibration(c Calibration) error
+
+	// Stream sends every conversion until ctx is cancelled, then the
+	// channel is closed. Errors are sent as readings with Err set, the
+	// stream keeps running. The scale must not be used otherwise while
+	// streaming.
+	Stream(ctx context.Context) <-chan Reading
+
+	// GetErrorCounts returns the reads and failed reads by class since
+	// the scale was opened or ResetErrorCounts.
+	GetErrorCounts() ErrorCounts
+	ResetErrorCounts()
+
+	Close() error
+}
+
+// Reading is a single conversion delivered by Stream. Err is a *ReadError
+// for failed reads. Channel is the input of the ADC the reading was taken
+// from, HX711_CHANNEL_A or B for the HX711 and the NAU7802_CHANNEL_* of the
+// NAU7802.
+type Reading struct {
+	Time    time.Time
+	Channel int
+	Raw     int
+	Weight  float64
+	Err     error
+
+	// Stable and ZeroOffset are set by Monitored: the weight is at rest
+	// and the zero tracking subtracted ZeroOffset from it.
+	Stable     bool
+	ZeroOffset float64
+
+	// Gross, Net and Tare are set by Tared, Weight is the net weight
+	// then.
+	Gross float64
+	Net   float64
+	Tare  float64
+}
+
+// Calibration converts raw readings to a weight.
+type Calibration struct {
+	Zero   int     `json:"zero"`
+	Factor float64 `json:"factor"` // counts per unit
+
+	// Curve replaces Factor if set.
+	Curve *calibration.Curve `json:"curve,omitempty"`
+}
+
+// Weight converts a raw reading with the curve if set, otherwise with the
+// factor.
+func (c Calibration) Weight(raw int) float64 {
+	if c.Curve != nil {
+		return c.Curve.Weight(float64(raw - c.Zero))
+	}
+	return float64(raw-c.Zero) / c.Factor
+}
+
+// Validate checks that the calibration converts readings to finite values.
+func (c Calibration) Validate() error {
+	if c.Curve != nil {
+		return c.Curve.Validate()
+	}
+	if c.Factor == 0 || math.IsNaN(c.Factor) || math.IsInf(c.Factor, 0) {
+		return fmt.Errorf("scale: invalid calibration factor %v", c.Factor)
+	}
+	return nil
+}
+
+func validateWeight(knownWeight float64) error {
+	if knownWeight == 0 || math.IsNaN(knownWeight) || math.IsInf(knownWeight, 0) {
+		return fmt.Errorf("scale: invalid reference weight %v", knownWeight)
+	}
+	return nil
+}
+
+func errSameAsZero(knownWeight float64) error {
+	return fmt.Errorf("scale: reading of %v equals the zero offset", knownWeight)
+}
+
+// factor returns the calibration factor for a reading of knownWeight.
+func factor(raw, zero int, knownWeight float64) (float64, error) {
+	if err := validateWeight(knownWeight); err != nil {
+		return 0, err
+	}
+	if raw == zero {
+		return 0, errSameAsZero(knownWeight)
+	}
+	return float64(raw-zero) / knownWeight, nil
+}
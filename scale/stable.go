@@ -0,0 +1,57 @@
+package scale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrNotStable = errors.New("scale: reading did not settle")
+
+// WaitStable reads the scale until the last count readings, each combined
+// from samples conversions, lie within tolerance counts of each other and
+// returns their mean. Readings not ready in time are retried. progress is
+// called with every reading and the current spread if not nil. It gives up
+// with ErrNotStable when ctx is done.
+func WaitStable(ctx context.Context, s Scale, samples, count, tolerance int, progress func(raw, spread int)) (int, error) {
+	if count < 1 {
+		return 0, ErrInvalidSampleCount
+	}
+
+	var window []int
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrNotStable, err)
+		}
+
+		raw, err := s.ReadRaw(samples)
+		if errors.Is(err, ErrNotReady) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if window = append(window, raw); len(window) > count {
+			window = window[1:]
+		}
+
+		lo, hi, sum := window[0], window[0], 0
+		for _, r := range window {
+			if r < lo {
+				lo = r
+			}
+			if r > hi {
+				hi = r
+			}
+			sum += r
+		}
+		if progress != nil {
+			progress(raw, hi-lo)
+		}
+
+		if len(window) == count && hi-lo <= tolerance {
+			return sum / count, nil
+		}
+	}
+}
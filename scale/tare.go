@@ -0,0 +1,257 @@
+package scale
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/SimonWaldherr/rpi-examples/jsonfile"
+)
+
+var (
+	ErrMotion      = errors.New("scale: weight not stable")
+	ErrNoReading   = errors.New("scale: no reading to tare yet")
+	ErrUnknownTare = errors.New("scale: unknown tare")
+)
+
+// TareMemory keeps the tares of containers by name, e.g. "bucket".
+type TareMemory map[string]float64
+
+// LoadTareMemory reads the tares stored by Save, without a file the memory
+// is empty.
+func LoadTareMemory(path string) (TareMemory, error) {
+	m := make(TareMemory)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+
+	if err = json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("scale: %s: %v", path, err)
+	}
+	return m, nil
+}
+
+// Save writes the tares as JSON, the file is replaced atomically.
+func (m TareMemory) Save(path string) error {
+	return jsonfile.Save(path, m)
+}
+
+// Names returns the names of the stored tares in order.
+func (m TareMemory) Names() []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Tared subtracts the tare of a container from the weights of ReadWeight
+// and the stream and reports gross, net and tare of every reading, Weight
+// is the net weight. The tare belongs to the first channel of the stream,
+// the weights of a second channel are passed with a tare of 0.
+type Tared struct {
+	Scale
+
+	// Memory holds the named tares, they are saved to Path if set.
+	Memory TareMemory
+	Path   string
+
+	mu      sync.Mutex
+	tare    float64
+	name    string
+	channel int
+	last    *Reading
+}
+
+// NewTared returns s without a tare.
+func NewTared(s Scale, memory TareMemory, path string) *Tared {
+	if memory == nil {
+		memory = make(TareMemory)
+	}
+	return &Tared{Scale: s, Memory: memory, Path: path}
+}
+
+// GetTare returns the tare and the name it was recalled by, the name is
+// empty for a pushed or preset tare.
+func (t *Tared) GetTare() (float64, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.tare, t.name
+}
+
+// PushTare makes the gross weight of the last reading of the stream the
+// tare, like the tare button of a scale. It is refused with ErrMotion while
+// the weight is not stable, unless the scale has no stability detection.
+func (t *Tared) PushTare() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.last == nil {
+		return ErrNoReading
+	}
+	if t.last.Err != nil {
+		return t.last.Err
+	}
+	if _, ok := t.Scale.(*Monitored); ok && !t.last.Stable {
+		return ErrMotion
+	}
+
+	t.tare, t.name = t.last.Gross, ""
+	return nil
+}
+
+// PresetTare sets a known tare, e.g. from the label of a container.
+func (t *Tared) PresetTare(weight float64) error {
+	if math.IsNaN(weight) || math.IsInf(weight, 0) || weight < 0 {
+		return fmt.Errorf("scale: invalid tare %v", weight)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tare, t.name = weight, ""
+	return nil
+}
+
+// ClearTare sets the tare to 0, net and gross weight are the same again.
+func (t *Tared) ClearTare() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tare, t.name = 0, ""
+}
+
+// RecallTare sets the tare stored as name.
+func (t *Tared) RecallTare(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tare, ok := t.Memory[name]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownTare, name)
+	}
+	t.tare, t.name = tare, name
+	return nil
+}
+
+// StoreTare stores the current tare as name and saves the memory.
+func (t *Tared) StoreTare(name string) error {
+	if name == "" {
+		return fmt.Errorf("scale: a stored tare needs a name")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Memory[name] = t.tare
+	t.name = name
+	return t.save()
+}
+
+// DeleteTare removes the tare stored as name and saves the memory.
+func (t *Tared) DeleteTare(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.Memory[name]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownTare, name)
+	}
+	delete(t.Memory, name)
+	if t.name == name {
+		t.name = ""
+	}
+	return t.save()
+}
+
+func (t *Tared) save() error {
+	if t.Path == "" {
+		return nil
+	}
+	return t.Memory.Save(t.Path)
+}
+
+// ReadWeight returns the net weight.
+func (t *Tared) ReadWeight(samples int) (float64, error) {
+	weight, err := t.Scale.ReadWeight(samples)
+	if err != nil {
+		return weight, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return weight - t.tare, nil
+}
+
+// Tare zeroes the scale with the container on it, which takes the place of
+// the tare of the container, so that is cleared.
+func (t *Tared) Tare(samples int) error {
+	if err := t.Scale.Tare(samples); err != nil {
+		return err
+	}
+	t.ClearTare()
+	return nil
+}
+
+// SelectTare presets spec if it is a weight, otherwise it recalls the tare
+// stored by that name. It takes the value of a -tare flag.
+func (t *Tared) SelectTare(spec string) error {
+	if weight, err := strconv.ParseFloat(spec, 64); err == nil {
+		return t.PresetTare(weight)
+	}
+	return t.RecallTare(spec)
+}
+
+// Stream keeps the tare of earlier streams.
+func (t *Tared) Stream(ctx context.Context) <-chan Reading {
+	ch := make(chan Reading, 16)
+	readings := t.Scale.Stream(ctx)
+
+	t.mu.Lock()
+	t.last = nil
+	t.mu.Unlock()
+
+	go func() {
+		defer close(ch)
+
+		for r := range readings {
+			r.Gross, r.Net = r.Weight, r.Weight
+
+			t.mu.Lock()
+			if t.last == nil {
+				t.channel = r.Channel
+			}
+			if r.Channel == t.channel {
+				if r.Err == nil {
+					r.Tare = t.tare
+					r.Net = r.Gross - t.tare
+					r.Weight = r.Net
+				}
+				last := r
+				t.last = &last
+			}
+			t.mu.Unlock()
+
+			select {
+			case ch <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}